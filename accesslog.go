@@ -0,0 +1,154 @@
+package gopher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+// AccessLogEntry describes a single request served by a Server.
+type AccessLogEntry struct {
+	Time       time.Time     // time the request was received
+	RemoteAddr string        // network address of the client
+	Selector   string        // selector as sent by the client, see Request.RawSelector
+	Query      string        // search query, if any
+	Kind       ResponseKind  // whether a menu or a document was sent
+	Items      int           // number of menu items written
+	Errors     int           // number of error items written
+	Bytes      int64         // number of bytes written
+	Duration   time.Duration // time taken to serve the request
+	TLS        bool          // whether the connection used TLS
+}
+
+func newAccessLogEntry(w *response, start time.Time) *AccessLogEntry {
+	return &AccessLogEntry{
+		Time:       start,
+		RemoteAddr: w.req.RemoteAddr,
+		Selector:   w.req.RawSelector,
+		Query:      w.req.Query,
+		Kind:       w.rt,
+		Items:      w.items,
+		Errors:     w.errors,
+		Bytes:      w.bytes,
+		Duration:   time.Since(start),
+		TLS:        w.req.TLS != nil,
+	}
+}
+
+// An AccessLogger records requests served by a Server.
+//
+// LogAccess is called from the goroutine serving the connection, after
+// the response has been sent; implementations must be safe for
+// concurrent use.
+type AccessLogger interface {
+	LogAccess(e *AccessLogEntry)
+}
+
+// The AccessLoggerFunc type is an adapter to allow the use of
+// ordinary functions as access loggers.
+type AccessLoggerFunc func(e *AccessLogEntry)
+
+// LogAccess calls f(e).
+func (f AccessLoggerFunc) LogAccess(e *AccessLogEntry) {
+	f(e)
+}
+
+// An AccessLogFormat renders an entry as a single line of output,
+// including the trailing newline.
+type AccessLogFormat func(e *AccessLogEntry) []byte
+
+// CombinedLogFormat renders an entry in a style similar to the Combined
+// Log Format of HTTP servers:
+//
+//	remote - - [time] "selector" kind items bytes errors duration tls
+//
+// The query, if any, is appended to the quoted selector after a tab.
+// The duration is in milliseconds and tls is either "tls" or "-".
+func CombinedLogFormat(e *AccessLogEntry) []byte {
+	request := e.Selector
+	if e.Query != "" {
+		request += "\t" + e.Query
+	}
+
+	tls := "-"
+	if e.TLS {
+		tls = "tls"
+	}
+
+	return []byte(fmt.Sprintf(
+		"%s - - [%s] %s %s %d %d %d %.3f %s\n",
+		e.RemoteAddr,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(request),
+		e.Kind,
+		e.Items,
+		e.Bytes,
+		e.Errors,
+		float64(e.Duration)/float64(time.Millisecond),
+		tls,
+	))
+}
+
+// JSONLogFormat renders an entry as a single line JSON object.
+func JSONLogFormat(e *AccessLogEntry) []byte {
+	b, err := json.Marshal(struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remote_addr"`
+		Selector   string  `json:"selector"`
+		Query      string  `json:"query,omitempty"`
+		Kind       string  `json:"kind"`
+		Items      int     `json:"items"`
+		Errors     int     `json:"errors"`
+		Bytes      int64   `json:"bytes"`
+		Duration   float64 `json:"duration_ms"`
+		TLS        bool    `json:"tls"`
+	}{
+		Time:       e.Time.Format(time.RFC3339Nano),
+		RemoteAddr: e.RemoteAddr,
+		Selector:   e.Selector,
+		Query:      e.Query,
+		Kind:       e.Kind.String(),
+		Items:      e.Items,
+		Errors:     e.Errors,
+		Bytes:      e.Bytes,
+		Duration:   float64(e.Duration) / float64(time.Millisecond),
+		TLS:        e.TLS,
+	})
+	if err != nil {
+		// Only strings and numbers are encoded; this cannot happen
+		panic("gopher: cannot encode access log entry: " + err.Error())
+	}
+	return append(b, '\n')
+}
+
+type writerAccessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+// NewAccessLogger returns an AccessLogger that writes every entry to w
+// using the given format. Writes are serialized, so w need not be safe
+// for concurrent use. If format is nil, CombinedLogFormat is used.
+//
+//	server := &gopher.Server{
+//	    AccessLog: gopher.NewAccessLogger(os.Stdout, gopher.JSONLogFormat),
+//	}
+func NewAccessLogger(w io.Writer, format AccessLogFormat) AccessLogger {
+	if format == nil {
+		format = CombinedLogFormat
+	}
+	return &writerAccessLogger{w: w, format: format}
+}
+
+func (l *writerAccessLogger) LogAccess(e *AccessLogEntry) {
+	b := l.format(e)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b)
+}
@@ -0,0 +1,103 @@
+package gopher_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entries := make(chan *gopher.AccessLogEntry, 1)
+
+	mux := gopher.NewServeMux()
+	mux.RedirectPolicy = gopher.ServeCanonical
+	mux.HandleFunc("/hello", hello)
+	mux.HandleFunc("/search", func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.Write([]byte("you searched for " + r.Query))
+	})
+
+	addr, stop := startServer(t, &gopher.Server{
+		Handler: mux,
+		AccessLog: gopher.AccessLoggerFunc(func(e *gopher.AccessLogEntry) {
+			entries <- e
+		}),
+	})
+	defer stop()
+
+	_, err := gopher.Get(fmt.Sprintf("gopher://%s/1hello", addr))
+	require.NoError(err)
+
+	e := <-entries
+	assert.Equal("/hello", e.Selector)
+	assert.Equal("", e.Query)
+	assert.Equal(gopher.MenuResponse, e.Kind)
+	assert.Equal(1, e.Items)
+	assert.Equal(0, e.Errors)
+	assert.Equal(int64(len("iHello World!\t\terror.host\t1\r\n.\r\n")), e.Bytes)
+	assert.False(e.TLS)
+
+	res, err := gopher.Get(fmt.Sprintf("gopher://%s/0search?gophers", addr))
+	require.NoError(err)
+	res.Body.Close()
+
+	e = <-entries
+	assert.Equal("/search", e.Selector)
+	assert.Equal("gophers", e.Query)
+	assert.Equal(gopher.DocumentResponse, e.Kind)
+	assert.Equal(0, e.Items)
+	assert.Equal(int64(len("you searched for gophers")), e.Bytes)
+
+	_, err = gopher.Get(fmt.Sprintf("gopher://%s/1missing", addr))
+	require.NoError(err)
+
+	e = <-entries
+	assert.Equal(1, e.Items)
+	assert.Equal(1, e.Errors)
+
+	// the selector is logged as sent, even when the mux serves another
+	_, err = gopher.Get(fmt.Sprintf("gopher://%s/1a/../hello", addr))
+	require.NoError(err)
+
+	e = <-entries
+	assert.Equal("/a/../hello", e.Selector)
+	assert.Equal(1, e.Items)
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &gopher.AccessLogEntry{
+		Time:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		RemoteAddr: "127.0.0.1:4242",
+		Selector:   "/search",
+		Query:      "gophers",
+		Kind:       gopher.MenuResponse,
+		Items:      3,
+		Errors:     1,
+		Bytes:      120,
+		Duration:   1500 * time.Microsecond,
+		TLS:        true,
+	}
+
+	assert.Equal(
+		`127.0.0.1:4242 - - [02/Jan/2020:03:04:05 +0000] "/search\tgophers" menu 3 120 1 1.500 tls`+"\n",
+		string(gopher.CombinedLogFormat(e)),
+	)
+	assert.JSONEq(
+		`{"time":"2020-01-02T03:04:05Z","remote_addr":"127.0.0.1:4242","selector":"/search","query":"gophers","kind":"menu","items":3,"errors":1,"bytes":120,"duration_ms":1.5,"tls":true}`,
+		string(gopher.JSONLogFormat(e)),
+	)
+
+	var buf bytes.Buffer
+	gopher.NewAccessLogger(&buf, nil).LogAccess(e)
+	assert.Equal(string(gopher.CombinedLogFormat(e)), buf.String())
+}
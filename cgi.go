@@ -0,0 +1,169 @@
+package gopher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCGITimeout is how long CGI scripts may run when no timeout is
+// given.
+const DefaultCGITimeout = 30 * time.Second
+
+// CGIHandler runs an executable in a child process, in the manner of
+// the CGI scripts of classic gopher servers, and replies with what it
+// writes to its standard output.
+//
+// The request is described to the script by the environment variables
+// SELECTOR, QUERY_STRING, REMOTE_ADDR, SERVER_NAME, SERVER_PORT,
+// SCRIPT_NAME and PATH_INFO. The output is sent as a document, or
+// parsed as a gophermap and sent as a menu.
+//
+// Scripts running longer than their timeout are killed, along with the
+// processes they started where the operating system allows it.
+type CGIHandler struct {
+	Path string   // path to the executable
+	Root string   // selector prefix of the handler; empty means "/"
+	Dir  string   // working directory of the script; defaults to the directory of Path
+	Args []string // optional arguments
+	Env  []string // extra environment variables, as "key=value"
+
+	// Gophermap makes the handler parse the output of the script as
+	// a gophermap in the given Dialect and reply with the menu it
+	// describes, resolving relative selectors against the directory
+	// of the request's selector.
+	Gophermap bool
+	Dialect   GophermapDialect
+
+	// Timeout is how long the script may run. If zero,
+	// DefaultCGITimeout is used.
+	Timeout time.Duration
+
+	// Stderr is where the script's standard error goes. If nil,
+	// os.Stderr is used.
+	Stderr io.Writer
+}
+
+func (h *CGIHandler) env(r *Request) []string {
+	root := h.Root
+	if root == "" {
+		root = "/"
+	}
+	pathInfo := r.Selector
+	if root != "/" && strings.HasPrefix(pathInfo, root) {
+		pathInfo = pathInfo[len(root):]
+	}
+
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	env := []string{
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_SOFTWARE=go-gopher",
+		"SERVER_NAME=" + r.LocalHost,
+		"SERVER_PORT=" + strconv.Itoa(r.LocalPort),
+		"SELECTOR=" + r.MountPoint + r.Selector,
+		"QUERY_STRING=" + r.Query,
+		"REMOTE_ADDR=" + remoteAddr,
+		"SCRIPT_NAME=" + r.MountPoint + root,
+		"PATH_INFO=" + pathInfo,
+	}
+	if p := os.Getenv("PATH"); p != "" {
+		env = append(env, "PATH="+p)
+	}
+	return append(env, h.Env...)
+}
+
+// run runs the script for r, writing its output to stdout.
+func (h *CGIHandler) run(r *Request, stdout io.Writer) error {
+	cmd := exec.Command(h.Path, h.Args...)
+	cmd.Dir = h.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = filepath.Dir(h.Path)
+	}
+	cmd.Env = h.env(r)
+	cmd.Stdout = stdout
+	cmd.Stderr = h.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultCGITimeout
+	}
+	var timedOut int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		killProcessGroup(cmd)
+	})
+	err := cmd.Wait()
+	timer.Stop()
+
+	if atomic.LoadInt32(&timedOut) != 0 {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return err
+}
+
+func (h *CGIHandler) ServeGopher(w ResponseWriter, r *Request) {
+	if h.Gophermap {
+		var buf bytes.Buffer
+		err := h.run(r, &buf)
+		if err == nil {
+			var g Gophermap
+			if g, err = ParseGophermap(&buf, h.Dialect); err == nil {
+				err = g.Menu(r, path.Dir(r.Selector)).Render(w)
+			}
+		}
+		if err != nil {
+			w.Server().logf("gopher: CGI %s: %v", h.Path, err)
+			Error(w, "Error running script")
+		}
+		return
+	}
+
+	sw := &streamWriter{w: w}
+	if err := h.run(r, sw); err != nil {
+		w.Server().logf("gopher: CGI %s: %v", h.Path, err)
+		if sw.n == 0 {
+			Error(w, "Error running script")
+		}
+	}
+}
+
+// streamWriter sends the output of a script to the client as it
+// arrives, flushing w after each write if it is a Flusher, and counts
+// the bytes written.
+type streamWriter struct {
+	w ResponseWriter
+	n int64
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	n, err := s.w.Write(b)
+	s.n += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if f, ok := s.w.(Flusher); ok {
+		err = f.Flush()
+	}
+	return n, err
+}
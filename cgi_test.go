@@ -0,0 +1,211 @@
+package gopher_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// writeScript writes an executable shell script called name in dir.
+func writeScript(t *testing.T, dir, name, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, ioutil.WriteFile(p, []byte("#!/bin/sh\n"+script), 0755))
+	return p
+}
+
+func TestCGIHandler(t *testing.T) {
+	dir := writeTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	h := &gopher.CGIHandler{
+		Path: writeScript(t, dir, "env.sh", `
+echo "SELECTOR=$SELECTOR"
+echo "QUERY_STRING=$QUERY_STRING"
+echo "REMOTE_ADDR=$REMOTE_ADDR"
+echo "SERVER=$SERVER_NAME:$SERVER_PORT"
+echo "SCRIPT_NAME=$SCRIPT_NAME"
+echo "PATH_INFO=$PATH_INFO"
+echo "EXTRA=$EXTRA"
+echo "PWD=$(pwd)"
+`),
+		Root: "/env",
+		Env:  []string{"EXTRA=yes"},
+	}
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{
+		Selector:   "/env/a/b",
+		Query:      "gophers",
+		RemoteAddr: "192.0.2.1:4242",
+		LocalHost:  "example.org",
+		LocalPort:  70,
+		MountPoint: "/cgi",
+	})
+
+	pwd, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECTOR=/cgi/env/a/b\n"+
+		"QUERY_STRING=gophers\n"+
+		"REMOTE_ADDR=192.0.2.1\n"+
+		"SERVER=example.org:70\n"+
+		"SCRIPT_NAME=/cgi/env\n"+
+		"PATH_INFO=/a/b\n"+
+		"EXTRA=yes\n"+
+		"PWD="+pwd+"\n", rec.body.String())
+}
+
+func TestCGIHandlerGophermap(t *testing.T) {
+	dir := writeTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	h := &gopher.CGIHandler{
+		Path: writeScript(t, dir, "menu.sh", `
+echo "Results for $QUERY_STRING"
+printf '0First\tfirst.txt\n'
+`),
+		Gophermap: true,
+	}
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/search/go", Query: "go"})
+	require.Len(t, rec.items, 2)
+	assert.Equal(t, "Results for go", rec.items[0].Description)
+	assert.Equal(t, "/search/first.txt", rec.items[1].Selector)
+}
+
+func TestCGIHandlerErrors(t *testing.T) {
+	dir := writeTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	marker := filepath.Join(dir, "survived")
+	var stderr bytes.Buffer
+	h := &gopher.CGIHandler{
+		Path: writeScript(t, dir, "slow.sh", `
+(sleep 1; touch `+marker+`) &
+echo "oops" >&2
+sleep 10
+`),
+		Timeout: 200 * time.Millisecond,
+		Stderr:  &stderr,
+	}
+
+	start := time.Now()
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/"})
+	assert.True(t, time.Since(start) < 5*time.Second)
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, "Error running script", rec.items[0].Description)
+	assert.Equal(t, "oops\n", stderr.String())
+
+	// the process started by the script is killed too
+	time.Sleep(1500 * time.Millisecond)
+	_, err := os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	h = &gopher.CGIHandler{Path: filepath.Join(dir, "missing.sh")}
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/"})
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, "Error running script", rec.items[0].Description)
+}
+
+func TestFileServerExecCGI(t *testing.T) {
+	dir := writeTree(t, map[string]string{"mole/notes.txt": "Notes.\n"})
+	defer os.RemoveAll(dir)
+
+	writeScript(t, dir, "hello.sh", `echo "Hello $QUERY_STRING"`)
+	writeScript(t, dir, "mole/gophermap", `
+echo "Generated"
+echo "*"
+`)
+
+	h := &gopher.FileHandler{Root: gopher.Dir(dir), ExecCGI: true}
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/hello.sh", Query: "world"})
+	assert.Equal(t, "Hello world\n", rec.body.String())
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/mole/"})
+	require.Len(t, rec.items, 2)
+	assert.Equal(t, "Generated", rec.items[0].Description)
+	assert.Equal(t, "/mole/notes.txt", rec.items[1].Selector)
+
+	// paths below a script are passed to it in PATH_INFO
+	writeScript(t, dir, "cgi/env.sh", `echo "$SCRIPT_NAME $PATH_INFO $SELECTOR"`)
+	mounted := gopher.StripPrefix("/files", h)
+	for selector, want := range map[string]string{
+		"/files/cgi/env.sh":      "/files/cgi/env.sh  /files/cgi/env.sh\n",
+		"/files/cgi/env.sh/a/b":  "/files/cgi/env.sh /a/b /files/cgi/env.sh/a/b\n",
+		"/files/cgi/env.sh/a/b/": "/files/cgi/env.sh /a/b/ /files/cgi/env.sh/a/b/\n",
+	} {
+		rec = &recorder{}
+		mounted.ServeGopher(rec, &gopher.Request{Selector: selector})
+		assert.Equal(t, want, rec.body.String(), selector)
+	}
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/cgi/missing.sh/a"})
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, gopher.ERROR, rec.items[0].Type)
+
+	// scripts are sent as files unless ExecCGI is set
+	rec = &recorder{}
+	gopher.FileServer(gopher.Dir(dir)).ServeGopher(rec, &gopher.Request{Selector: "/hello.sh"})
+	assert.Equal(t, "#!/bin/sh\necho \"Hello $QUERY_STRING\"", rec.body.String())
+}
+
+func TestCGIHandlerStreaming(t *testing.T) {
+	dir := writeTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	h := &gopher.CGIHandler{Path: writeScript(t, dir, "slow.sh", `
+echo first
+sleep 2
+echo second
+`)}
+	addr, stop := startServer(t, &gopher.Server{Handler: h})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("/\r\n"))
+	require.NoError(t, err)
+
+	// the first line arrives while the script is still running
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", line)
+}
+
+func TestFileServerExecCGISymlink(t *testing.T) {
+	dir := writeTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	script := writeScript(t, dir, "real.sh", `echo "$0 $SCRIPT_NAME"`)
+	require.NoError(t, os.Symlink("real.sh", filepath.Join(dir, "link.sh")))
+	resolved, err := filepath.EvalSymlinks(script)
+	require.NoError(t, err)
+
+	// the script is run by the path the symlink policy checked
+	h := &gopher.FileHandler{Root: gopher.Dir(dir), ExecCGI: true}
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/link.sh"})
+	assert.Equal(t, resolved+" /link.sh\n", rec.body.String())
+}
@@ -0,0 +1,304 @@
+package gopher
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes at the start of a file that
+// FileSample.Head returns.
+const sniffLen = 512
+
+// A FileSample is a file whose item type is being detected.
+type FileSample struct {
+	// Name is the slash-separated name of the file.
+	Name string
+
+	// Info describes the file. It may be nil.
+	Info os.FileInfo
+
+	// Open opens the file to read its content. If nil, the file is
+	// taken to be empty.
+	Open func() (io.ReadCloser, error)
+
+	head []byte
+	read bool
+}
+
+// Head returns the first bytes of the file, at most 512 of them, or
+// nil if it cannot be read. The file is read the first time Head is
+// called, so detectors that don't need the content don't read it.
+func (s *FileSample) Head() []byte {
+	if s.read {
+		return s.head
+	}
+	s.read = true
+	if s.Open == nil {
+		return nil
+	}
+	rc, err := s.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+
+	b := make([]byte, sniffLen)
+	n, _ := io.ReadFull(rc, b)
+	s.head = b[:n]
+	return s.head
+}
+
+// A TypeDetector detects the item types of files.
+//
+// DetectType returns the item type of the file s, and false if it
+// cannot tell. It may be called concurrently for different files.
+type TypeDetector interface {
+	DetectType(s *FileSample) (ItemType, bool)
+}
+
+// The TypeDetectorFunc type is an adapter to allow the use of ordinary
+// functions as TypeDetectors.
+type TypeDetectorFunc func(s *FileSample) (ItemType, bool)
+
+// DetectType calls f(s).
+func (f TypeDetectorFunc) DetectType(s *FileSample) (ItemType, bool) {
+	return f(s)
+}
+
+// TypeDetectors is a chain of TypeDetectors. It detects the type
+// returned by the first detector that can tell.
+type TypeDetectors []TypeDetector
+
+func (ds TypeDetectors) DetectType(s *FileSample) (ItemType, bool) {
+	for _, d := range ds {
+		if d == nil {
+			continue
+		}
+		if t, ok := d.DetectType(s); ok {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// TypeOverrides detects the types of files by their names. A key may be
+// the full slash-separated name of a file or its base name; the full
+// name takes precedence.
+type TypeOverrides map[string]ItemType
+
+func (o TypeOverrides) DetectType(s *FileSample) (ItemType, bool) {
+	if t, ok := o[s.Name]; ok {
+		return t, true
+	}
+	t, ok := o[path.Base(s.Name)]
+	return t, ok
+}
+
+// ExtensionTypes detects the types of files by their extensions, such
+// as ".txt". Keys are lowercase, and extensions are matched regardless
+// of case.
+type ExtensionTypes map[string]ItemType
+
+func (e ExtensionTypes) DetectType(s *FileSample) (ItemType, bool) {
+	ext := strings.ToLower(path.Ext(s.Name))
+	if ext == "" {
+		return 0, false
+	}
+	t, ok := e[ext]
+	return t, ok
+}
+
+// A MagicNumber is a sequence of bytes identifying a file format, found
+// at Offset in files of that format.
+type MagicNumber struct {
+	Offset int
+	Magic  []byte
+	Type   ItemType
+}
+
+// MagicNumbers detects the types of files by the magic numbers they
+// start with. The first matching MagicNumber decides.
+type MagicNumbers []MagicNumber
+
+func (ms MagicNumbers) DetectType(s *FileSample) (ItemType, bool) {
+	head := s.Head()
+	for _, m := range ms {
+		if len(head) >= m.Offset+len(m.Magic) && bytes.Equal(head[m.Offset:m.Offset+len(m.Magic)], m.Magic) {
+			return m.Type, true
+		}
+	}
+	return 0, false
+}
+
+// DefaultMagicNumbers are the magic numbers of common formats.
+var DefaultMagicNumbers = MagicNumbers{
+	{0, []byte("GIF87a"), GIF},
+	{0, []byte("GIF89a"), GIF},
+	{0, []byte("\x89PNG\r\n\x1a\n"), IMAGE},
+	{0, []byte("\xff\xd8\xff"), IMAGE},
+	{0, []byte("BM"), IMAGE},
+	{0, []byte("%PDF-"), DOC},
+	{0, []byte("ID3"), AUDIO},
+	{0, []byte("OggS"), AUDIO},
+	{0, []byte("fLaC"), AUDIO},
+	{0, []byte("MThd"), AUDIO},
+	{8, []byte("WAVE"), AUDIO},
+	{0, []byte("PK\x03\x04"), DOSARCHIVE},
+	{0, []byte("\x1f\x8b"), DOSARCHIVE},
+	{0, []byte("BZh"), DOSARCHIVE},
+	{0, []byte("\xfd7zXZ\x00"), DOSARCHIVE},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), DOSARCHIVE},
+	{257, []byte("ustar"), DOSARCHIVE},
+	{0, []byte("\x7fELF"), BINARY},
+}
+
+// MimeTypePatterns detects the types of files by the MIME types sniffed
+// from their content, as by http.DetectContentType. Keys are patterns
+// as used by path.Match, such as "text/*". Where several patterns
+// match, the most specific wins: one without wildcards, then the one
+// with the most other characters, then the first in lexical order.
+type MimeTypePatterns map[string]ItemType
+
+func (p MimeTypePatterns) DetectType(s *FileSample) (ItemType, bool) {
+	head := s.Head()
+	if len(head) == 0 {
+		return 0, false
+	}
+	mimeType := strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+	return p.match(mimeType)
+}
+
+// match returns the type of the most specific pattern matching
+// mimeType.
+func (p MimeTypePatterns) match(mimeType string) (ItemType, bool) {
+	if t, ok := p[mimeType]; ok {
+		return t, true
+	}
+
+	best, bestScore := "", -1
+	for pattern := range p {
+		if ok, _ := path.Match(pattern, mimeType); !ok {
+			continue
+		}
+		score := len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+		if score > bestScore || score == bestScore && pattern < best {
+			best, bestScore = pattern, score
+		}
+	}
+	if bestScore < 0 {
+		return 0, false
+	}
+	return p[best], true
+}
+
+// FileExtensions defines a mapping of known file extensions to gopher types
+//
+// Deprecated: set the Types of a FileHandler to detect types otherwise.
+// FileExtensions is still used by DefaultTypeDetector.
+var FileExtensions = map[string]ItemType{
+	".txt":  FILE,
+	".gif":  GIF,
+	".jpg":  IMAGE,
+	".jpeg": IMAGE,
+	".png":  IMAGE,
+	".html": HTML,
+	".ogg":  AUDIO,
+	".mp3":  AUDIO,
+	".wav":  AUDIO,
+	".mod":  AUDIO,
+	".it":   AUDIO,
+	".xm":   AUDIO,
+	".mid":  AUDIO,
+	".vgm":  AUDIO,
+	".s":    FILE,
+	".c":    FILE,
+	".py":   FILE,
+	".h":    FILE,
+	".md":   FILE,
+	".go":   FILE,
+	".fs":   FILE,
+}
+
+// MimeTypes defines a mapping of known mimetypes to gopher types
+//
+// Deprecated: set the Types of a FileHandler to detect types otherwise.
+// MimeTypes is still used by DefaultTypeDetector.
+var MimeTypes = map[string]ItemType{
+	"text/html": HTML,
+	"text/*":    FILE,
+
+	"image/gif": GIF,
+	"image/*":   IMAGE,
+
+	"audio/*": AUDIO,
+
+	"application/pdf": DOC,
+
+	"application/x-tar":  DOSARCHIVE,
+	"application/x-gtar": DOSARCHIVE,
+
+	"application/x-xz":    DOSARCHIVE,
+	"application/x-zip":   DOSARCHIVE,
+	"application/x-gzip":  DOSARCHIVE,
+	"application/x-bzip2": DOSARCHIVE,
+	"application/zip":     DOSARCHIVE,
+}
+
+// NewTypeDetector returns the default chain of detectors: the given
+// overrides, then the extensions of FileExtensions, then
+// DefaultMagicNumbers, then the MIME type patterns of MimeTypes.
+func NewTypeDetector(overrides TypeOverrides) TypeDetector {
+	return TypeDetectors{
+		overrides,
+		ExtensionTypes(FileExtensions),
+		DefaultMagicNumbers,
+		MimeTypePatterns(MimeTypes),
+	}
+}
+
+// DefaultTypeDetector is the TypeDetector used by GetItemType and by
+// FileHandlers without Types.
+var DefaultTypeDetector = NewTypeDetector(nil)
+
+// detectItemType returns the item type of the file s detected by d,
+// or DEFAULT if d cannot tell.
+func detectItemType(d TypeDetector, s *FileSample) ItemType {
+	if s.Info != nil && s.Info.IsDir() {
+		return DIRECTORY
+	}
+	if d == nil {
+		d = DefaultTypeDetector
+	}
+	if t, ok := d.DetectType(s); ok {
+		return t
+	}
+	return DEFAULT
+}
+
+// GetItemType returns the Gopher Type of the given path
+func GetItemType(p string) ItemType {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return DEFAULT
+	}
+	return detectItemType(DefaultTypeDetector, &FileSample{
+		Name: filepath.ToSlash(p),
+		Info: fi,
+		Open: func() (io.ReadCloser, error) { return os.Open(p) },
+	})
+}
+
+// itemType returns the Gopher Type of the file called name, described
+// by fi.
+func (f *FileHandler) itemType(name string, fi os.FileInfo) ItemType {
+	return detectItemType(f.Types, &FileSample{
+		Name: name,
+		Info: fi,
+		Open: func() (io.ReadCloser, error) { return f.open(name) },
+	})
+}
@@ -0,0 +1,111 @@
+package gopher_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// sample returns a FileSample of the given content, counting how many
+// times it is opened.
+func sample(name, content string, opened *int) *gopher.FileSample {
+	return &gopher.FileSample{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			*opened++
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestTypeDetectors(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	tests := []struct {
+		name     string
+		detector gopher.TypeDetector
+		file     string
+		content  string
+		want     gopher.ItemType
+		ok       bool
+		opened   int
+	}{
+		{"override by name", gopher.TypeOverrides{"README": gopher.DIRECTORY}, "/docs/README", "", gopher.DIRECTORY, true, 0},
+		{"override by path", gopher.TypeOverrides{"README": gopher.DIRECTORY, "/docs/README": gopher.HTML}, "/docs/README", "", gopher.HTML, true, 0},
+		{"no override", gopher.TypeOverrides{"README": gopher.DIRECTORY}, "/docs/NEWS", "", 0, false, 0},
+		{"extension", gopher.ExtensionTypes{".txt": gopher.FILE}, "/NOTES.TXT", "", gopher.FILE, true, 0},
+		{"no extension", gopher.ExtensionTypes{".txt": gopher.FILE}, "/notes", "", 0, false, 0},
+		{"magic gif", gopher.DefaultMagicNumbers, "/pic", "GIF89a...", gopher.GIF, true, 1},
+		{"magic at offset", gopher.DefaultMagicNumbers, "/backup", string(tar), gopher.DOSARCHIVE, true, 1},
+		{"magic wav", gopher.DefaultMagicNumbers, "/sound", "RIFF\x00\x00\x00\x00WAVEfmt ", gopher.AUDIO, true, 1},
+		{"no magic", gopher.DefaultMagicNumbers, "/notes", "plain text", 0, false, 1},
+		{"mime exact", gopher.MimeTypePatterns{"text/*": gopher.FILE, "text/html": gopher.HTML}, "/page", "<html><body>", gopher.HTML, true, 1},
+		{"mime wildcard", gopher.MimeTypePatterns{"text/*": gopher.FILE, "text/html": gopher.HTML}, "/notes", "plain text", gopher.FILE, true, 1},
+		{"mime most specific", gopher.MimeTypePatterns{"*/*": gopher.BINARY, "text/*": gopher.FILE, "text/p*": gopher.DOC}, "/notes", "plain text", gopher.DOC, true, 1},
+		{"mime empty", gopher.MimeTypePatterns{"*/*": gopher.BINARY}, "/empty", "", 0, false, 1},
+		{"default extension first", gopher.DefaultTypeDetector, "/pic.txt", "GIF89a...", gopher.FILE, true, 0},
+		{"default magic before mime", gopher.DefaultTypeDetector, "/doc", "%PDF-1.4\n", gopher.DOC, true, 1},
+		{"default mime", gopher.DefaultTypeDetector, "/page", "<!DOCTYPE html><p>", gopher.HTML, true, 1},
+		{"default unknown", gopher.DefaultTypeDetector, "/blob", "\x00\x01\x02", 0, false, 1},
+		{"overrides first", gopher.NewTypeDetector(gopher.TypeOverrides{"pic.txt": gopher.GIF}), "/pic.txt", "", gopher.GIF, true, 0},
+		{"chain skips nil", gopher.TypeDetectors{nil, gopher.ExtensionTypes{".c": gopher.FILE}}, "/main.c", "", gopher.FILE, true, 0},
+		{"func", gopher.TypeDetectorFunc(func(s *gopher.FileSample) (gopher.ItemType, bool) {
+			return gopher.BINARY, bytes.HasPrefix(s.Head(), []byte("#!"))
+		}), "/run", "#!/bin/sh", gopher.BINARY, true, 1},
+	}
+
+	for _, tt := range tests {
+		opened := 0
+		s := sample(tt.file, tt.content, &opened)
+		got, ok := tt.detector.DetectType(s)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		if tt.ok {
+			assert.Equal(t, tt.want, got, tt.name)
+		}
+		assert.Equal(t, tt.opened, opened, "%s: times opened", tt.name)
+	}
+}
+
+func TestMimeTypePatternsDeterministic(t *testing.T) {
+	patterns := gopher.MimeTypePatterns{
+		"text/*":  gopher.FILE,
+		"text/p*": gopher.DOC,
+		"text/?*": gopher.HTML,
+		"*/*":     gopher.BINARY,
+		"t*/*":    gopher.AUDIO,
+	}
+	for i := 0; i < 100; i++ {
+		got, ok := patterns.DetectType(sample("/notes", "plain text", new(int)))
+		assert.True(t, ok)
+		assert.Equal(t, gopher.DOC, got)
+	}
+}
+
+func TestFileServerTypes(t *testing.T) {
+	fs := memFS{
+		"/notes":    "plain text",
+		"/data.bin": "\x00\x01\x02",
+		"/pic":      "GIF89a...",
+	}
+
+	items := listing(gopher.FileServer(fs), "/")
+	assert.Equal(t, []gopher.ItemType{gopher.BINARY, gopher.FILE, gopher.GIF}, itemTypes(items))
+
+	h := &gopher.FileHandler{Root: fs, Types: gopher.NewTypeDetector(gopher.TypeOverrides{"notes": gopher.DIRECTORY})}
+	assert.Equal(t, []gopher.ItemType{gopher.BINARY, gopher.DIRECTORY, gopher.GIF}, itemTypes(listing(h, "/")))
+}
+
+func itemTypes(items []*gopher.Item) []gopher.ItemType {
+	types := make([]gopher.ItemType, len(items))
+	for i, item := range items {
+		types[i] = item.Type
+	}
+	return types
+}
@@ -0,0 +1,96 @@
+package gopher_test
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// rawRequest sends line to the server at addr and returns its raw reply.
+func rawRequest(t *testing.T, addr, line string) string {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(line))
+	require.NoError(t, err)
+
+	reply, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	return string(reply)
+}
+
+func TestServeMuxNotFoundHandler(t *testing.T) {
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/hello", hello)
+	mux.NotFoundHandler = gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo("Nothing here at " + r.Selector)
+		w.WriteItem(&gopher.Item{Type: gopher.INDEXSEARCH, Description: "Search", Selector: "/search"})
+		w.WriteItem(&gopher.Item{Type: gopher.DIRECTORY, Description: "Home", Selector: "/"})
+	})
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/missing"})
+	require.Len(t, rec.items, 3)
+	assert.Equal(t, "Nothing here at /missing", rec.items[0].Description)
+	assert.Equal(t, gopher.INDEXSEARCH, rec.items[1].Type)
+	assert.Equal(t, "/", rec.items[2].Selector)
+
+	_, pattern := mux.Handler(&gopher.Request{Selector: "/missing"})
+	assert.Equal(t, "", pattern)
+
+	rec = &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/hello"})
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, "Hello World!", rec.items[0].Description)
+}
+
+func TestServerErrorTemplate(t *testing.T) {
+	mux := gopher.NewServeMux()
+	addr, stop := startServer(t, &gopher.Server{
+		Handler:       mux,
+		ErrorTemplate: &gopher.Item{Host: "example.org", Port: 70},
+	})
+	defer stop()
+
+	reply := rawRequest(t, addr, "/missing\r\n")
+	assert.Equal(t, "3resource not found\t\texample.org\t70\r\n.\r\n", reply)
+}
+
+func TestServerBadRequest(t *testing.T) {
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/hello", hello)
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+
+	reply := rawRequest(t, addr, "/hel\x00lo\r\n")
+	assert.Equal(t, "3bad request\t\terror.host\t1\r\n.\r\n", reply)
+
+	reply = rawRequest(t, addr, strings.Repeat("a", 1<<17)+"\r\n")
+	assert.Equal(t, "3bad request\t\terror.host\t1\r\n.\r\n", reply)
+}
+
+func TestServerBadRequestHandler(t *testing.T) {
+	var selector string
+	addr, stop := startServer(t, &gopher.Server{
+		Handler: gopher.HandlerFunc(hello),
+		BadRequestHandler: gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+			selector = r.Selector
+			w.WriteError("please check your request")
+			w.WriteItem(&gopher.Item{Type: gopher.DIRECTORY, Description: "Home", Selector: "/"})
+		}),
+	})
+	defer stop()
+
+	reply := rawRequest(t, addr, "/a\rb\r\n")
+	assert.Equal(t, "", selector)
+	assert.True(t, strings.HasPrefix(reply, "3please check your request\t"), reply)
+	assert.True(t, strings.HasSuffix(reply, "\r\n.\r\n"), reply)
+	assert.Contains(t, reply, "1Home\t/\t127.0.0.1\t")
+}
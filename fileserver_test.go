@@ -0,0 +1,138 @@
+package gopher_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// memFS is an in-memory FileSystem mapping slash-separated paths to file
+// contents. Directories are implied by the paths of their files.
+type memFS map[string]string
+
+func (fs memFS) Name() string { return "mem" }
+
+func (fs memFS) Open(name string) (gopher.File, error) {
+	name = path.Clean("/" + name)
+	if content, ok := fs[name]; ok {
+		return &memFile{Reader: bytes.NewReader([]byte(content)), info: memInfo{path.Base(name), int64(len(content)), false}}, nil
+	}
+
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	seen := make(map[string]bool)
+	var entries []os.FileInfo
+	for p, content := range fs {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(p, prefix)
+		entry, dir := rest, false
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			entry, dir = rest[:i], true
+		}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		entries = append(entries, memInfo{entry, int64(len(content)), dir})
+	}
+	if len(entries) == 0 && name != "/" {
+		return nil, os.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() > entries[j].Name() })
+	return &memFile{Reader: bytes.NewReader(nil), info: memInfo{path.Base(name), 0, true}, entries: entries}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	info    memInfo
+	entries []os.FileInfo
+}
+
+func (f *memFile) Close() error                             { return nil }
+func (f *memFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) { return f.entries, nil }
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi memInfo) Name() string       { return fi.name }
+func (fi memInfo) Size() int64        { return fi.size }
+func (fi memInfo) ModTime() time.Time { return time.Time{} }
+func (fi memInfo) IsDir() bool        { return fi.dir }
+func (fi memInfo) Sys() interface{}   { return nil }
+
+func (fi memInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func TestFileServerMemFS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := memFS{
+		"/hello.txt":        "Hello World!\n",
+		"/main.go":          "package main\n",
+		"/page":             "<html><body>" + strings.Repeat("x", 600) + "</body></html>",
+		"/.hidden":          "secret",
+		"/docs/guide.txt":   "A guide.\n",
+		"/phlog/gophermap":  "iWelcome to my phlog\t\terror.host\t1\r\n",
+		"/phlog/first.txt":  "First post.\n",
+		"/empty/sub/x.data": "x",
+	}
+	h := gopher.FileServer(fs)
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/", LocalHost: "localhost", LocalPort: 70})
+	require.Len(rec.items, 6)
+
+	want := []struct {
+		t        gopher.ItemType
+		selector string
+	}{
+		{gopher.DIRECTORY, "/docs"},
+		{gopher.DIRECTORY, "/empty"},
+		{gopher.FILE, "/hello.txt"},
+		{gopher.FILE, "/main.go"},
+		{gopher.HTML, "/page"},
+		{gopher.DIRECTORY, "/phlog"},
+	}
+	for i, w := range want {
+		assert.Equal(w.t, rec.items[i].Type, w.selector)
+		assert.Equal(w.selector, rec.items[i].Selector)
+	}
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/docs"})
+	require.Len(rec.items, 1)
+	assert.Equal("/docs/guide.txt", rec.items[0].Selector)
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/docs/guide.txt"})
+	assert.Equal("A guide.\n", rec.body.String())
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/phlog/"})
+	require.Len(rec.items, 1)
+	assert.Equal("Welcome to my phlog", rec.items[0].Description)
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/missing"})
+	require.Len(rec.items, 1)
+	assert.Equal(gopher.ERROR, rec.items[0].Type)
+}
@@ -0,0 +1,226 @@
+package gopher
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// FS converts fsys to a FileSystem implementation, for use with
+// FileServer and TemplateHandler. It makes it possible to serve files
+// embedded in the binary with embed.FS, or from zip archives and other
+// fs.FS implementations:
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	sub, _ := fs.Sub(static, "static")
+//	gopher.Handle("/", gopher.FileServer(gopher.FS(sub)))
+//
+// Files that cannot seek are read into memory the first time they are
+// seeked.
+func FS(fsys fs.FS) FileSystem {
+	if f, ok := fsys.(fileSystemFS); ok {
+		return f.fsys
+	}
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) Name() string {
+	return "."
+}
+
+func (f ioFS) Open(name string) (File, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ioFile{file: file, fsys: f.fsys, name: name}, nil
+}
+
+// An ioFile is a File read from an fs.FS.
+type ioFile struct {
+	file fs.File
+	fsys fs.FS
+	name string
+
+	// buf holds the contents of a file that cannot seek, once
+	// seeked, and is read instead of file
+	buf *bytes.Reader
+
+	// read is the number of bytes read from file
+	read int64
+
+	// entries holds the entries of a directory that cannot read them
+	// itself, left to return by Readdir
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *ioFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *ioFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *ioFile) Read(b []byte) (int, error) {
+	if f.buf != nil {
+		return f.buf.Read(b)
+	}
+	n, err := f.file.Read(b)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if f.buf != nil {
+		return f.buf.Seek(offset, whence)
+	}
+	if s, ok := f.file.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.read, nil
+	}
+
+	b, err := fs.ReadFile(f.fsys, f.name)
+	if err != nil {
+		return 0, err
+	}
+	f.buf = bytes.NewReader(b)
+	if _, err := f.buf.Seek(f.read, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return f.buf.Seek(offset, whence)
+}
+
+func (f *ioFile) Readdir(count int) ([]os.FileInfo, error) {
+	var (
+		entries []fs.DirEntry
+		err     error
+	)
+	if d, ok := f.file.(fs.ReadDirFile); ok {
+		entries, err = d.ReadDir(count)
+	} else {
+		entries, err = f.readDir(count)
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, ierr := e.Info()
+		if ierr != nil {
+			return infos, ierr
+		}
+		infos = append(infos, fi)
+	}
+	return infos, err
+}
+
+// readDir reads the entries of a directory that isn't an
+// fs.ReadDirFile with fs.ReadDir, and returns them as
+// fs.ReadDirFile.ReadDir would.
+func (f *ioFile) readDir(count int) ([]fs.DirEntry, error) {
+	if !f.listed {
+		entries, err := fs.ReadDir(f.fsys, f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.listed = entries, true
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+// IOFS converts fsys to an fs.FS implementation, so the files of a
+// FileSystem may be used with packages such as html/template or
+// io/fs itself.
+func IOFS(fsys FileSystem) fs.FS {
+	if f, ok := fsys.(ioFS); ok {
+		return f.fsys
+	}
+	return fileSystemFS{fsys}
+}
+
+type fileSystemFS struct {
+	fsys FileSystem
+}
+
+func (f fileSystemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := f.fsys.Open("/" + name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	return &fsFile{file}, nil
+}
+
+// unwrapPathError returns the error underlying err, so the path in
+// errors returned by fileSystemFS is not repeated.
+func unwrapPathError(err error) error {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		return perr.Err
+	}
+	return err
+}
+
+// An fsFile is an fs.File read from a FileSystem.
+type fsFile struct {
+	File
+}
+
+func (f *fsFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	infos, err := f.File.Readdir(count)
+	entries := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		entries[i] = dirEntry{fi}
+	}
+	if count <= 0 && err == io.EOF {
+		err = nil
+	}
+	return entries, err
+}
+
+// A dirEntry is an fs.DirEntry describing an os.FileInfo.
+type dirEntry struct {
+	fi os.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.fi.Name() }
+func (d dirEntry) IsDir() bool                { return d.fi.IsDir() }
+func (d dirEntry) Type() fs.FileMode          { return d.fi.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.fi, nil }
+
+var (
+	_ fs.ReadDirFile = (*fsFile)(nil)
+	_ File           = (*ioFile)(nil)
+)
@@ -0,0 +1,158 @@
+package gopher_test
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+//go:embed testdata/files
+var testFiles embed.FS
+
+// streamFS hides the optional methods of the regular files of an fs.FS,
+// such as Seek, as if they were read from a stream.
+type streamFS struct {
+	fsys fs.FS
+}
+
+func (s streamFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.(fs.ReadDirFile); ok {
+		return f, nil
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestFS(t *testing.T) {
+	sub, err := fs.Sub(testFiles, "testdata/files")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		fsys fs.FS
+	}{
+		{"embed", sub},
+		{"map", fstest.MapFS{
+			"notes.txt":      {Data: []byte("Some notes.\n")},
+			"sub/readme.txt": {Data: []byte("Read me.\n")},
+		}},
+		{"stream", streamFS{sub}},
+	}
+
+	for _, tt := range tests {
+		h := gopher.FileServer(gopher.FS(tt.fsys))
+
+		rec := &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: "/"})
+		if assert.Len(t, rec.items, 2, tt.name) {
+			assert.Equal(t, gopher.FILE, rec.items[0].Type, tt.name)
+			assert.Equal(t, "/notes.txt", rec.items[0].Selector, tt.name)
+			assert.Equal(t, gopher.DIRECTORY, rec.items[1].Type, tt.name)
+			assert.Equal(t, "/sub", rec.items[1].Selector, tt.name)
+		}
+
+		rec = &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: "/notes.txt"})
+		assert.Equal(t, "Some notes.\n", rec.body.String(), tt.name)
+
+		rec = &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: "/sub/../../notes.txt"})
+		assert.Equal(t, "Some notes.\n", rec.body.String(), tt.name)
+
+		rec = &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: "/missing.txt"})
+		if assert.Len(t, rec.items, 1, tt.name) {
+			assert.Equal(t, gopher.ERROR, rec.items[0].Type, tt.name)
+		}
+	}
+}
+
+func TestFSSeek(t *testing.T) {
+	f, err := gopher.FS(streamFS{fstest.MapFS{
+		"abc": {Data: []byte("abcdef")},
+	}}).Open("/abc")
+	require.NoError(t, err)
+	defer f.Close()
+
+	b := make([]byte, 2)
+	_, err = io.ReadFull(f, b)
+	require.NoError(t, err)
+	assert.Equal(t, "ab", string(b))
+
+	pos, err := f.Seek(1, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, pos)
+
+	rest, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "def", string(rest))
+}
+
+// plainDirFS opens directories as files that cannot list themselves,
+// leaving fs.ReadDir to list them through the ReadDir method of the
+// file system.
+type plainDirFS struct {
+	fstest.MapFS
+}
+
+func (p plainDirFS) Open(name string) (fs.File, error) {
+	f, err := p.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestFSReaddirPages(t *testing.T) {
+	d, err := gopher.FS(plainDirFS{fstest.MapFS{
+		"a": {}, "b": {}, "c": {}, "d": {}, "e": {},
+	}}).Open("/")
+	require.NoError(t, err)
+	defer d.Close()
+
+	var names []string
+	for i := 0; i < 10; i++ {
+		infos, err := d.Readdir(2)
+		if err == io.EOF {
+			assert.Empty(t, infos)
+			break
+		}
+		require.NoError(t, err)
+		assert.True(t, len(infos) <= 2, "%d entries", len(infos))
+		for _, fi := range infos {
+			names = append(names, fi.Name())
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, names)
+
+	infos, err := d.Readdir(-1)
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestIOFS(t *testing.T) {
+	fsys := gopher.IOFS(gopher.Dir("testdata/files"))
+	require.NoError(t, fstest.TestFS(fsys, "notes.txt", "sub/readme.txt"))
+
+	b, err := fs.ReadFile(fsys, "sub/readme.txt")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "Read"), string(b))
+
+	_, err = fsys.Open("../gophermap")
+	assert.Error(t, err)
+
+	// converting back and forth returns the original
+	assert.Equal(t, fsys, gopher.IOFS(gopher.FS(fsys)))
+}
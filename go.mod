@@ -7,4 +7,4 @@ require (
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
 )
 
-go 1.13
+go 1.16
@@ -16,16 +16,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	sync "github.com/sasha-s/go-deadlock"
 	"golang.org/x/net/context"
@@ -441,6 +442,37 @@ type Request struct {
 	LocalHost  string
 	LocalPort  int
 	RemoteAddr string
+
+	// Query is the search string sent by clients of Index-Search
+	// (type 7) items, i.e. the field following the first tab of the
+	// request line. It is empty for ordinary requests.
+	Query string
+
+	// TLS is the state of the TLS connection the request arrived on,
+	// or nil for plain text connections.
+	TLS *tls.ConnectionState
+
+	// Pattern is the ServeMux pattern that matched the request.
+	// It is set by ServeMux before calling the matched handler and
+	// is empty if no pattern matched.
+	Pattern string
+
+	// RawSelector is the selector as requested by the client, with a
+	// leading slash added if missing. Unlike Selector it is never
+	// changed by RewriteHandler, StripPrefix or ServeMux.
+	RawSelector string
+
+	// MountPoint is the prefix removed from Selector by StripPrefix or
+	// ServeMux.Mount, or empty if the handler is not mounted. The
+	// selector originally requested is MountPoint + Selector.
+	MountPoint string
+
+	// params holds the values captured by the placeholders of Pattern.
+	params map[string]string
+
+	// route is how the ServeMux serving the request answers it, once
+	// its middleware has run.
+	route *muxRoute
 }
 
 // A Handler responds to a Gopher request.
@@ -460,97 +492,6 @@ type Handler interface {
 	ServeGopher(ResponseWriter, *Request)
 }
 
-// FileExtensions defines a mapping of known file extensions to gopher types
-var FileExtensions = map[string]ItemType{
-	".txt":  FILE,
-	".gif":  GIF,
-	".jpg":  IMAGE,
-	".jpeg": IMAGE,
-	".png":  IMAGE,
-	".html": HTML,
-	".ogg":  AUDIO,
-	".mp3":  AUDIO,
-	".wav":  AUDIO,
-	".mod":  AUDIO,
-	".it":   AUDIO,
-	".xm":   AUDIO,
-	".mid":  AUDIO,
-	".vgm":  AUDIO,
-	".s":    FILE,
-	".c":    FILE,
-	".py":   FILE,
-	".h":    FILE,
-	".md":   FILE,
-	".go":   FILE,
-	".fs":   FILE,
-}
-
-// MimeTypes defines a mapping of known mimetypes to gopher types
-var MimeTypes = map[string]ItemType{
-	"text/html": HTML,
-	"text/*":    FILE,
-
-	"image/gif": GIF,
-	"image/*":   IMAGE,
-
-	"audio/*": AUDIO,
-
-	"application/x-tar":  DOSARCHIVE,
-	"application/x-gtar": DOSARCHIVE,
-
-	"application/x-xz":    DOSARCHIVE,
-	"application/x-zip":   DOSARCHIVE,
-	"application/x-gzip":  DOSARCHIVE,
-	"application/x-bzip2": DOSARCHIVE,
-}
-
-func matchExtension(f os.FileInfo) ItemType {
-	extension := strings.ToLower(filepath.Ext(f.Name()))
-	k, ok := FileExtensions[extension]
-	if !ok {
-		return DEFAULT
-	}
-	return k
-}
-
-func matchMimeType(mimeType string) ItemType {
-	for k, v := range MimeTypes {
-		matched, err := filepath.Match(k, mimeType)
-		if !matched || (err != nil) {
-			continue
-		}
-		return v
-	}
-	return DEFAULT
-}
-
-// GetItemType returns the Gopher Type of the given path
-func GetItemType(p string) ItemType {
-	fi, err := os.Stat(p)
-	if err != nil {
-		return DEFAULT
-	}
-
-	if fi.IsDir() {
-		return DIRECTORY
-	}
-
-	f, err := os.Open(p)
-	if err != nil {
-		return matchExtension(fi)
-	}
-
-	b := make([]byte, 512)
-	n, err := io.ReadAtLeast(f, b, 512)
-	if (err != nil) || (n != 512) {
-		return matchExtension(fi)
-	}
-
-	mimeType := http.DetectContentType(b)
-	mimeParts := strings.Split(mimeType, ";")
-	return matchMimeType(mimeParts[0])
-}
-
 // Server defines parameters for running a Gopher server.
 // A zero value for Server is valid configuration.
 type Server struct {
@@ -564,6 +505,52 @@ type Server struct {
 	// If nil, logging goes to os.Stderr via the log package's
 	// standard logger.
 	ErrorLog *log.Logger
+
+	// AccessLog specifies an optional logger that is called once for
+	// every request after its response has been sent.
+	AccessLog AccessLogger
+
+	// Metrics specifies optional instrumentation that records
+	// connections and requests handled by the server.
+	Metrics *Metrics
+
+	// ConnState specifies an optional callback function that is
+	// called when a client connection changes state. See the
+	// ConnState type and associated constants for details.
+	ConnState func(net.Conn, ConnState)
+
+	// Trace specifies optional callbacks fired at each stage of
+	// serving a request.
+	Trace *ServerTrace
+
+	// BadRequestHandler specifies an optional handler that replies
+	// to malformed requests, such as request lines that are too long.
+	// Its Request has an empty Selector. If nil, an error item saying
+	// "bad request" is written.
+	BadRequestHandler Handler
+
+	// ErrorTemplate specifies an optional item used as the template
+	// of the error items written with WriteError: each error item is
+	// a copy of it with the error message as Description. If nil,
+	// error items point at host "error.host", port 1.
+	ErrorTemplate *Item
+
+	mu         sync.Mutex
+	started    time.Time
+	activeConn map[*conn]struct{}
+}
+
+func (s *Server) trackConn(c *conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activeConn == nil {
+		s.activeConn = make(map[*conn]struct{})
+	}
+	if add {
+		s.activeConn[c] = struct{}{}
+	} else {
+		delete(s.activeConn, c)
+	}
 }
 
 // serverHandler delegates to either the server's Handler or
@@ -639,6 +626,12 @@ func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 func (s *Server) Serve(l net.Listener) error {
 	defer l.Close()
 
+	s.mu.Lock()
+	if s.started.IsZero() {
+		s.started = time.Now()
+	}
+	s.mu.Unlock()
+
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, ServerContextKey, s)
 	ctx = context.WithValue(ctx, LocalAddrContextKey, l.Addr())
@@ -646,10 +639,14 @@ func (s *Server) Serve(l net.Listener) error {
 	for {
 		rw, err := l.Accept()
 		if err != nil {
+			if s.Metrics != nil {
+				s.Metrics.acceptError()
+			}
 			return fmt.Errorf("error accepting new client: %s", err)
 		}
 
 		c := s.newConn(rw)
+		c.setState(StateNew)
 		go c.serve(ctx)
 	}
 }
@@ -674,13 +671,45 @@ type conn struct {
 
 	// mu guards hijackedv, use of bufr, (*response).closeNotifyCh.
 	mu sync.Mutex
+
+	// bufr reads from rwc. It is handed to the Handler by Hijack, with
+	// whatever it has buffered past the request line.
+	bufr *bufio.Reader
+
+	// hijackedv is whether this connection has been hijacked
+	// by a Handler with the Hijacker interface.
+	// It is guarded by mu.
+	hijackedv bool
+
+	// accepted is the time the connection was accepted.
+	accepted time.Time
+
+	// selector is the selector being served, once the request has
+	// been read. Guarded by server.mu.
+	selector string
+
+	// released is whether the connection is no longer counted as
+	// active. It is guarded by mu.
+	released bool
+}
+
+// logf logs to the server's ErrorLog, or the standard logger if it is
+// nil. A nil Server logs to the standard logger.
+func (s *Server) logf(format string, args ...interface{}) {
+	if s != nil && s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
 }
 
 // Create new connection from rwc.
 func (s *Server) newConn(rwc net.Conn) *conn {
 	c := &conn{
-		server: s,
-		rwc:    rwc,
+		server:   s,
+		rwc:      rwc,
+		bufr:     bufio.NewReader(rwc),
+		accepted: time.Now(),
 	}
 	return c
 }
@@ -688,33 +717,142 @@ func (s *Server) newConn(rwc net.Conn) *conn {
 func (c *conn) serve(ctx context.Context) {
 	c.remoteAddr = c.rwc.RemoteAddr().String()
 
-	w, err := c.readRequest(ctx)
+	c.server.trackConn(c, true)
+	if m := c.server.Metrics; m != nil {
+		m.connOpened()
+	}
+	defer c.release()
 
+	trace := c.server.Trace
+
+	start := time.Now()
+	trace.readRequestStart()
+
+	var handler Handler = serverHandler{c.server}
+
+	w, err := c.readRequest(ctx)
 	if err != nil {
+		trace.readRequestDone(nil, err)
 		if err == io.EOF {
+			c.close()
 			return // don't reply
 		}
 		if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+			c.close()
 			return // don't reply
 		}
-		io.WriteString(c.rwc, "3\tbad request\terror.host\t0")
-		return
+
+		if err == bufio.ErrTooLong {
+			c.discardInput()
+		}
+		w, err = c.newResponse(ctx, &Request{})
+		if err != nil {
+			c.close()
+			return
+		}
+		handler = c.server.BadRequestHandler
+		if handler == nil {
+			handler = HandlerFunc(badRequest)
+		}
 	}
 
+	w.start = start
 	w.req.RemoteAddr = c.remoteAddr
+	if tlsConn, ok := c.rwc.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		w.req.TLS = &state
+	}
+	if err == nil {
+		trace.readRequestDone(w.req, nil)
+	}
+	c.setState(StateActive)
+
+	c.server.mu.Lock()
+	c.selector = w.req.Selector
+	c.server.mu.Unlock()
+
+	trace.handlerStart(w.req)
+	handler.ServeGopher(w, w.req)
+	trace.handlerDone(w.req)
 
-	serverHandler{c.server}.ServeGopher(w, w.req)
-	w.End()
+	err = w.End()
+	trace.responseDone(w.req, err)
+
+	// a hijacked response is recorded once its handler returns
+	w.record()
 }
 
-func readRequest(rwc net.Conn) (req *Request, err error) {
-	reader := bufio.NewReader(rwc)
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanLines)
-	scanner.Scan()
+// rstAvoidanceDelay is how long the server waits for the rest of an
+// oversized request before replying to it, so that unread data doesn't
+// make the kernel reset the connection before the client reads the
+// reply. See net/http's closeWriteAndWait.
+const rstAvoidanceDelay = 100 * time.Millisecond
+
+// discardInput reads and throws away what the client is still sending,
+// up to a limit and for at most rstAvoidanceDelay.
+func (c *conn) discardInput() {
+	c.rwc.SetReadDeadline(time.Now().Add(rstAvoidanceDelay))
+	io.Copy(ioutil.Discard, io.LimitReader(c.rwc, 256<<10))
+}
+
+// errBadRequest is returned by readRequest for malformed request lines.
+var errBadRequest = errors.New("gopher: malformed request")
+
+// badRequest is the default Server.BadRequestHandler.
+func badRequest(w ResponseWriter, r *Request) {
+	Error(w, "bad request")
+}
+
+// maxRequestLine is the longest request line read, terminator
+// included.
+const maxRequestLine = bufio.MaxScanTokenSize
+
+// readLine reads a line from br, without its terminating newline and
+// carriage return. It reads nothing past the newline, so that what
+// follows stays buffered in br. Lines longer than maxRequestLine
+// return bufio.ErrTooLong.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := br.ReadSlice('\n')
+		line = append(line, b...)
+		if len(line) > maxRequestLine {
+			return "", bufio.ErrTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return "", err
+		}
+		break
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return string(line), nil
+}
+
+func readRequest(br *bufio.Reader) (req *Request, err error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ContainsAny(line, "\x00\r") {
+		return nil, errBadRequest
+	}
 
 	req = &Request{
-		Selector: scanner.Text(),
+		Selector: line,
+	}
+
+	// Index-Search requests carry the query after a tab
+	if i := strings.IndexByte(req.Selector, TAB); i >= 0 {
+		req.Query = req.Selector[i+1:]
+		req.Selector = req.Selector[:i]
+		if j := strings.IndexByte(req.Query, TAB); j >= 0 {
+			req.Query = req.Query[:j]
+		}
 	}
 
 	// If empty selector, assume /
@@ -727,6 +865,8 @@ func readRequest(rwc net.Conn) (req *Request, err error) {
 		req.Selector = "/" + req.Selector
 	}
 
+	req.RawSelector = req.Selector
+
 	return req, nil
 }
 
@@ -734,17 +874,55 @@ func (c *conn) close() (err error) {
 	c.mu.Lock() // while using bufr
 	err = c.rwc.Close()
 	c.mu.Unlock()
+	c.release()
+	c.setState(StateClosed)
 	return
 }
 
+// release stops counting the connection as active, once its response
+// is complete or its handler has returned. Only the first call has an
+// effect.
+func (c *conn) release() {
+	c.mu.Lock()
+	released := c.released
+	c.released = true
+	c.mu.Unlock()
+	if released {
+		return
+	}
+
+	c.server.trackConn(c, false)
+	if m := c.server.Metrics; m != nil {
+		m.connClosed()
+	}
+}
+
+func (c *conn) hijacked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hijackedv
+}
+
+func (c *conn) setState(state ConnState) {
+	if hook := c.server.ConnState; hook != nil {
+		hook(c.rwc, state)
+	}
+}
+
 func (c *conn) readRequest(ctx context.Context) (w *response, err error) {
 	c.mu.Lock() // while using bufr
-	req, err := readRequest(c.rwc)
+	req, err := readRequest(c.bufr)
 	c.mu.Unlock()
 	if err != nil {
 		return nil, err
 	}
 
+	return c.newResponse(ctx, req)
+}
+
+// newResponse prepares the response to req, filling in the local
+// address of the connection.
+func (c *conn) newResponse(ctx context.Context, req *Request) (w *response, err error) {
 	localaddr := ctx.Value(LocalAddrContextKey).(*net.TCPAddr)
 	host, port, err := net.SplitHostPort(localaddr.String())
 	if err != nil {
@@ -858,6 +1036,26 @@ func ListenAndServeTLS(addr, certFile, keyFile string, handler Handler) error {
 // the pattern "/" matches all paths not matched by other registered
 // patterns, not just the URL with Path == "/".
 //
+// A segment of a pattern may also be a placeholder, like "{slug}",
+// which matches any non-empty segment, or a typed placeholder, like
+// "{year:int}", which only matches segments of that type. The types
+// int, hex, alpha and alnum are predefined; any other type is a
+// regular expression the whole segment must match, as in
+// "{id:[a-z]{3}[0-9]+}". The last segment may be a wildcard, like
+// "*rest", which matches the remainder of the selector, including
+// further slashes, much like a rooted subtree. Captured values are
+// returned by Request.Param:
+//
+//	mux.HandleFunc("/posts/{year:int}/{slug}", post)
+//	mux.HandleFunc("/tags/{tag}/*rest", tagged)
+//
+// When several patterns match a selector, segments are compared from
+// left to right and the first difference decides: a fixed segment wins
+// over a typed placeholder, which wins over an untyped placeholder,
+// which wins over a wildcard or subtree. Typed placeholders of
+// different types are tried in the order they were registered. The
+// result therefore never depends on the order of the routes in a map.
+//
 // If a subtree has been registered and a request is received naming the
 // subtree root without its trailing slash, ServeMux redirects that
 // request to the subtree root (adding the trailing slash). This behavior can
@@ -868,16 +1066,58 @@ func ListenAndServeTLS(addr, certFile, keyFile string, handler Handler) error {
 //
 // ServeMux also takes care of sanitizing the URL request path,
 // redirecting any request containing . or .. elements or repeated slashes
-// to an equivalent, cleaner URL.
+// to an equivalent, cleaner URL. Selectors of the form "URL:..." are
+// left alone.
+//
+// Gopher has no redirect status, so a redirect is a menu holding a
+// single item that points at the canonical selector, as written by
+// Redirect. The RedirectPolicy field may be used to serve the canonical
+// selector directly instead, or to reply with an error item.
+//
+// Middleware wraps the matched handler in a fixed order: first the
+// middleware registered with Use, in the order added, then the
+// middleware given when the pattern was registered, in the order given,
+// and finally the handler itself. Redirects and rejected selectors go
+// through the middleware registered with Use too.
 type ServeMux struct {
-	mu sync.RWMutex
-	m  map[string]muxEntry
+	// RedirectPolicy decides how requests for selectors that are not
+	// canonical are answered. The zero value replies with a redirect
+	// menu.
+	RedirectPolicy RedirectPolicy
+
+	// NotFoundHandler specifies an optional handler for requests that
+	// match no pattern, for instance to reply with a menu linking
+	// home. If nil, NotFound is used.
+	NotFoundHandler Handler
+
+	mu    sync.RWMutex
+	m     map[string]*muxEntry
+	tree  routeNode
+	mw    []Middleware
+	chain Handler // mw wrapped around dispatch, rebuilt by Use
+}
+
+// A muxRoute is how ServeMux answers a request, decided before its
+// middleware runs.
+type muxRoute struct {
+	e        *muxEntry
+	redirect *Item // the canonical item, if the selector isn't canonical
+	reject   bool  // reply with an error instead of redirecting
 }
 
 type muxEntry struct {
-	explicit bool
+	hits uint64 // requests dispatched, updated atomically
+
 	h        Handler
 	pattern  string
+	names    []string // names of the values captured by pattern
+	wildcard bool     // pattern is a subtree or ends in a wildcard
+	wildName string   // name of the trailing wildcard, if any
+
+	// set by RouteOptions
+	mw          []Middleware
+	description string
+	itemType    ItemType
 }
 
 // NewServeMux allocates and returns a new ServeMux.
@@ -888,36 +1128,6 @@ var DefaultServeMux = &defaultServeMux
 
 var defaultServeMux ServeMux
 
-// Does selector match pattern?
-func selectorMatch(pattern, selector string) bool {
-	if len(pattern) == 0 {
-		// should not happen
-		return false
-	}
-	n := len(pattern)
-	if pattern[n-1] != '/' {
-		return pattern == selector
-	}
-	return len(selector) >= n && selector[0:n] == pattern
-}
-
-// Find a handler on a handler map given a path string
-// Most-specific (longest) pattern wins
-func (mux *ServeMux) match(selector string) (h Handler, pattern string) {
-	var n = 0
-	for k, v := range mux.m {
-		if !selectorMatch(k, selector) {
-			continue
-		}
-		if h == nil || len(k) > n {
-			n = len(k)
-			h = v.h
-			pattern = v.pattern
-		}
-	}
-	return
-}
-
 // Handler returns the handler to use for the given request,
 // consulting r.Selector. It always returns
 // a non-nil handler.
@@ -925,19 +1135,31 @@ func (mux *ServeMux) match(selector string) (h Handler, pattern string) {
 // Handler also returns the registered pattern that matches the request.
 //
 // If there is no registered handler that applies to the request,
-// Handler returns a ``resource not found'' handler and an empty pattern.
+// Handler returns the mux's NotFoundHandler, or a ``resource not found''
+// handler if that is nil, and an empty pattern.
 func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
-	return mux.handler(r.Selector)
+	e, _ := mux.handler(r.Selector)
+	return e.h, e.pattern
 }
 
 // handler is the main implementation of Handler.
-func (mux *ServeMux) handler(selector string) (h Handler, pattern string) {
+// It also returns the values captured by placeholders of the pattern.
+func (mux *ServeMux) handler(selector string) (e *muxEntry, params []string) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
-	h, pattern = mux.match(selector)
-	if h == nil {
-		h, pattern = NotFoundHandler(), ""
+	return mux.lookup(selector)
+}
+
+// lookup finds the entry for selector. mux.mu must be held.
+func (mux *ServeMux) lookup(selector string) (e *muxEntry, params []string) {
+	e, params = mux.tree.lookup(selector, 0, nil)
+	if e == nil {
+		h := mux.NotFoundHandler
+		if h == nil {
+			h = NotFoundHandler()
+		}
+		e, params = &muxEntry{h: h}, nil
 	}
 
 	return
@@ -946,35 +1168,168 @@ func (mux *ServeMux) handler(selector string) (h Handler, pattern string) {
 // ServeGopher dispatches the request to the handler whose
 // pattern most closely matches the request URL.
 func (mux *ServeMux) ServeGopher(w ResponseWriter, r *Request) {
-	h, _ := mux.Handler(r)
+	mux.mu.RLock()
+	route := mux.route(r)
+	h := mux.chain
+	mux.mu.RUnlock()
+
+	if h == nil {
+		h = HandlerFunc(mux.dispatch)
+	}
+	r.route = route
 	h.ServeGopher(w, r)
 }
 
+// route decides how mux answers r, setting its Selector, Pattern and
+// params. mux.mu must be held, so that everything is resolved from a
+// single view of the routes and concurrent changes never produce a mix
+// of old and new ones.
+func (mux *ServeMux) route(r *Request) *muxRoute {
+	canonical, target := mux.canonical(r.Selector)
+	if canonical != r.Selector && mux.RedirectPolicy == ServeCanonical {
+		r.Selector = canonical
+	}
+	if canonical != r.Selector {
+		r.Pattern = ""
+		return &muxRoute{
+			redirect: &Item{Type: target.redirectType(r, canonical), Selector: canonical},
+			reject:   mux.RedirectPolicy == RejectNonCanonical,
+		}
+	}
+
+	e, params := mux.lookup(r.Selector)
+	r.Pattern = e.pattern
+	r.setParams(e.names, params)
+	return &muxRoute{e: e}
+}
+
+// dispatch answers r as decided by ServeGopher, once the middleware
+// registered with Use has run.
+func (mux *ServeMux) dispatch(w ResponseWriter, r *Request) {
+	route := r.route
+	r.route = nil
+	if route == nil {
+		// the middleware passed on a request of its own
+		mux.mu.RLock()
+		route = mux.route(r)
+		mux.mu.RUnlock()
+	}
+
+	switch {
+	case route.reject:
+		Error(w, "invalid selector")
+	case route.redirect != nil:
+		Redirect(w, r, route.redirect)
+	default:
+		atomic.AddUint64(&route.e.hits, 1)
+		route.e.h.ServeGopher(w, r)
+	}
+}
+
+// Use appends middleware to the chain that wraps every request
+// dispatched by mux, including requests that match no pattern and
+// requests answered with a redirect or an error for selectors that are
+// not canonical.
+//
+// Middleware registered with Use runs before any route middleware
+// given to Handle, in the order it was added: the first middleware is
+// the outermost one. Request.Pattern is already set when it runs, and
+// is empty for redirected requests. The middleware wraps mux once,
+// when Use is called, so state it sets up is kept across requests.
+func (mux *ServeMux) Use(middleware ...Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for _, m := range middleware {
+		if m == nil {
+			panic("gopher: nil middleware")
+		}
+	}
+	mux.mw = append(mux.mw, middleware...)
+	mux.chain = Chain(HandlerFunc(mux.dispatch), mux.mw...)
+}
+
 // Handle registers the handler for the given pattern.
-// If a handler already exists for pattern, Handle panics.
-func (mux *ServeMux) Handle(pattern string, handler Handler) {
+// If a handler already exists for pattern, or for a pattern matching
+// exactly the same selectors, such as "/posts/{id}" and "/posts/{slug}",
+// Handle panics.
+//
+// Options may describe the route, see Describe and WithItemType, or be
+// Middleware. Middleware given wraps handler only, so it runs just for
+// requests matching pattern, after the middleware registered with Use
+// and in the order given.
+func (mux *ServeMux) Handle(pattern string, handler Handler, opts ...RouteOption) {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
 
+	mux.handle(pattern, handler, opts, false)
+}
+
+// handle registers handler for pattern, replacing any conflicting
+// registration if replace is true. mux.mu must be held.
+func (mux *ServeMux) handle(pattern string, handler Handler, opts []RouteOption, replace bool) {
 	if pattern == "" {
 		panic("gopher: invalid pattern " + pattern)
 	}
 	if handler == nil {
 		panic("gopher: nil handler")
 	}
-	if mux.m[pattern].explicit {
+	for _, opt := range opts {
+		if m, ok := opt.(Middleware); opt == nil || ok && m == nil {
+			panic("gopher: nil route option")
+		}
+	}
+	if _, exist := mux.m[pattern]; exist && !replace {
 		panic("gopher: multiple registrations for " + pattern)
 	}
 
+	segs, wildcard, wildName := parsePattern(pattern)
+	n := mux.tree.node(pattern, segs)
+
+	slot := &n.exact
+	if wildcard {
+		slot = &n.wildcard
+	}
+	if old := *slot; old != nil {
+		if !replace {
+			panic("gopher: pattern " + pattern + " conflicts with " + old.pattern)
+		}
+		delete(mux.m, old.pattern)
+	}
+
+	e := &muxEntry{
+		pattern:  pattern,
+		names:    paramNames(segs, wildcard, wildName),
+		wildcard: wildcard,
+		wildName: wildName,
+	}
+	for _, opt := range opts {
+		opt.applyRoute(e)
+	}
+	e.h = Chain(handler, e.mw...)
+	*slot = e
+
 	if mux.m == nil {
-		mux.m = make(map[string]muxEntry)
+		mux.m = make(map[string]*muxEntry)
+	}
+	mux.m[pattern] = e
+}
+
+// hits returns the number of requests dispatched to each pattern.
+func (mux *ServeMux) hits() map[string]uint64 {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	hits := make(map[string]uint64, len(mux.m))
+	for k, v := range mux.m {
+		hits[k] = atomic.LoadUint64(&v.hits)
 	}
-	mux.m[pattern] = muxEntry{explicit: true, h: handler, pattern: pattern}
+	return hits
 }
 
 // HandleFunc registers the handler function for the given pattern.
-func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
-	mux.Handle(pattern, HandlerFunc(handler))
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request), opts ...RouteOption) {
+	mux.Handle(pattern, HandlerFunc(handler), opts...)
 }
 
 // The HandlerFunc type is an adapter to allow the use of
@@ -1014,6 +1369,84 @@ type ResponseWriter interface {
 	WriteItem(i *Item) error
 }
 
+// ResponseKind describes what a handler has written in reply to a request.
+type ResponseKind int
+
+const (
+	// NoResponse means nothing has been written yet
+	NoResponse ResponseKind = iota
+
+	// DocumentResponse means raw document data was written with Write
+	DocumentResponse
+
+	// MenuResponse means items were written, terminated by END on End
+	MenuResponse
+)
+
+// String returns a lowercase name for the response kind
+func (k ResponseKind) String() string {
+	switch k {
+	case DocumentResponse:
+		return "document"
+	case MenuResponse:
+		return "menu"
+	default:
+		return "none"
+	}
+}
+
+// ErrHijacked is returned by ResponseWriter methods called after the
+// underlying connection has been taken over with Hijacker.Hijack.
+var ErrHijacked = errors.New("gopher: connection has been hijacked")
+
+// The Flusher interface is implemented by ResponseWriters that allow a
+// Gopher handler to flush buffered data to the client.
+//
+// Output is otherwise buffered until End, so streaming handlers should
+// call Flush after each chunk they want the client to see. Flushing a
+// menu does not terminate it.
+//
+// Wrappers of ResponseWriter may not implement Flusher, so handlers
+// should always test for this ability at runtime.
+type Flusher interface {
+	// Flush sends any buffered data to the client.
+	Flush() error
+}
+
+// The Hijacker interface is implemented by ResponseWriters that allow a
+// Gopher handler to take over the connection.
+type Hijacker interface {
+	// Hijack lets the caller take over the connection.
+	// After a call to Hijack the Gopher server library
+	// will not do anything else with the connection: it will not
+	// write the menu terminator nor close the connection.
+	//
+	// The returned bufio.Writer holds any output the handler has
+	// already written but not yet flushed.
+	//
+	// It becomes the caller's responsibility to manage
+	// and close the connection.
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+}
+
+// The ResponseInfo interface is implemented by ResponseWriters that
+// report what has been written so far, so that middleware can inspect
+// the outcome of the handlers it wraps.
+type ResponseInfo interface {
+	// Kind reports whether a menu or a document is being written
+	Kind() ResponseKind
+
+	// BytesWritten returns the number of bytes written so far,
+	// including item framing and, once ended, the menu terminator
+	BytesWritten() int64
+
+	// ItemsWritten returns the number of menu items written so far
+	ItemsWritten() int
+
+	// WroteError reports whether an error item has been written
+	WroteError() bool
+}
+
 // A response represents the server side of a Gopher response.
 type response struct {
 	conn *conn
@@ -1022,7 +1455,34 @@ type response struct {
 
 	w *bufio.Writer // buffers output
 
-	rt int
+	rt ResponseKind
+
+	bytes  int64 // bytes written, including item framing
+	items  int   // items written to a menu
+	errors int   // error items written to a menu
+
+	start    time.Time // when the server started reading the request
+	ended    bool      // End has been called
+	recorded bool      // the metrics and access log have the response
+}
+
+// record adds the response to the metrics and access log of the
+// server, the first time it is called. End calls it before sending the
+// end of the response, so that a client that has read it also sees its
+// request counted.
+func (w *response) record() {
+	if w.recorded {
+		return
+	}
+	w.recorded = true
+
+	s := w.conn.server
+	if s.Metrics != nil {
+		s.Metrics.observe(w, w.start)
+	}
+	if s.AccessLog != nil {
+		s.AccessLog.LogAccess(newAccessLogEntry(w, w.start))
+	}
 }
 
 func (w *response) Server() *Server {
@@ -1030,24 +1490,37 @@ func (w *response) Server() *Server {
 }
 
 func (w *response) Write(b []byte) (int, error) {
-	if w.rt == 0 {
-		w.rt = 1
+	if w.rt == NoResponse {
+		w.rt = DocumentResponse
 	}
 
-	if w.rt != 1 {
+	if w.rt != DocumentResponse {
 		return 0, errors.New("cannot write document data to a directory")
 	}
 
-	return w.w.Write(b)
+	return w.write(b)
+}
+
+// write writes b to the buffered connection and accounts for it.
+func (w *response) write(b []byte) (int, error) {
+	if w.conn.hijacked() {
+		return 0, ErrHijacked
+	}
+	if w.bytes == 0 && len(b) > 0 {
+		w.conn.server.Trace.wroteFirstByte(w.req)
+	}
+	n, err := w.w.Write(b)
+	w.bytes += int64(n)
+	return n, err
 }
 
 func (w *response) WriteError(err string) error {
-	if w.rt == 0 {
-		w.rt = 2
+	if w.rt == NoResponse {
+		w.rt = MenuResponse
 	}
 
-	if w.rt != 2 {
-		_, e := w.w.Write([]byte(err))
+	if w.rt != MenuResponse {
+		_, e := w.write([]byte(err))
 		return e
 	}
 
@@ -1057,17 +1530,23 @@ func (w *response) WriteError(err string) error {
 		Host:        "error.host",
 		Port:        1,
 	}
+	if t := w.conn.server.ErrorTemplate; t != nil {
+		item := *t
+		item.Type = ERROR
+		item.Description = err
+		i = &item
+	}
 
 	return w.WriteItem(i)
 }
 
 func (w *response) WriteInfo(msg string) error {
-	if w.rt == 0 {
-		w.rt = 2
+	if w.rt == NoResponse {
+		w.rt = MenuResponse
 	}
 
-	if w.rt != 2 {
-		_, e := w.w.Write([]byte(msg))
+	if w.rt != MenuResponse {
+		_, e := w.write([]byte(msg))
 		return e
 	}
 
@@ -1082,11 +1561,11 @@ func (w *response) WriteInfo(msg string) error {
 }
 
 func (w *response) WriteItem(i *Item) error {
-	if w.rt == 0 {
-		w.rt = 2
+	if w.rt == NoResponse {
+		w.rt = MenuResponse
 	}
 
-	if w.rt != 2 {
+	if w.rt != MenuResponse {
 		return errors.New("cannot write directory data to a document")
 	}
 
@@ -1100,30 +1579,75 @@ func (w *response) WriteItem(i *Item) error {
 		return err
 	}
 
-	_, err = w.w.Write(b)
+	_, err = w.write(b)
 	if err != nil {
 		return err
 	}
 
+	w.items++
+	if i.Type == ERROR {
+		w.errors++
+	}
+
 	return nil
 }
 
+func (w *response) Flush() error {
+	if w.conn.hijacked() {
+		return ErrHijacked
+	}
+	return w.w.Flush()
+}
+
+func (w *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.ended {
+		return nil, nil, errors.New("gopher: response has already ended")
+	}
+
+	c := w.conn
+	c.mu.Lock()
+	if c.hijackedv {
+		c.mu.Unlock()
+		return nil, nil, ErrHijacked
+	}
+	c.hijackedv = true
+	c.mu.Unlock()
+	c.setState(StateHijacked)
+
+	rw := bufio.NewReadWriter(c.bufr, w.w)
+	return c.rwc, rw, nil
+}
+
+func (w *response) Kind() ResponseKind  { return w.rt }
+func (w *response) BytesWritten() int64 { return w.bytes }
+func (w *response) ItemsWritten() int   { return w.items }
+func (w *response) WroteError() bool    { return w.errors > 0 }
+
 func (w *response) End() (err error) {
-	if w.rt == 2 {
-		_, err = w.w.Write(append([]byte{END}, CRLF...))
-		if err != nil {
-			return
-		}
+	if w.ended {
+		return nil
 	}
+	w.ended = true
 
-	err = w.w.Flush()
-	if err != nil {
-		return
+	if w.conn.hijacked() {
+		return nil
 	}
 
-	err = w.conn.close()
-	if err != nil {
-		return
+	if w.rt == MenuResponse {
+		_, err = w.write(append([]byte{END}, CRLF...))
+	}
+
+	// the client may send its next request as soon as it reads the
+	// end of the response, so it is recorded before being flushed
+	w.record()
+	w.conn.release()
+
+	if err == nil {
+		err = w.w.Flush()
+	}
+
+	if cerr := w.conn.close(); err == nil {
+		err = cerr
 	}
 
 	return
@@ -1148,8 +1672,122 @@ func NotFound(w ResponseWriter, r *Request) {
 // that replies to each request with a ``resource page not found'' reply.
 func NotFoundHandler() Handler { return HandlerFunc(NotFound) }
 
-type fileHandler struct {
-	root FileSystem
+// A FileHandler serves Gopher requests with the contents of the file
+// system Root. Directories are listed, unless they hold a gophermap
+// file, which is rendered instead as described for Gophermap.
+//
+// Listings take the descriptions, types and links of their entries
+// from the sidecar files ".gopherdesc" and ".gopher.json" of the
+// directory, if present. A .gopherdesc file holds lines made of a file
+// name, a tab and a description. A .gopher.json file maps file names
+// to objects with any of the fields "description", "type", "hidden",
+// "host", "port" and "selector". Hidden entries, and the sidecar files
+// themselves, are answered as missing.
+//
+// A ".gopherignore" file lists patterns of the names of files the
+// handler leaves out of listings and answers as missing, in the
+// directory holding it and those below. Patterns follow the syntax of
+// .gitignore files: "*", "?" and "[...]" match within a name, "**"
+// matches any number of directories, a pattern holding a "/" matches
+// paths relative to the directory of the file, a trailing "/" matches
+// directories only, and a leading "!" includes again what an earlier
+// pattern, or that of a parent directory, left out. The .gopherignore
+// files are answered as missing too.
+//
+// FileServer returns a FileHandler with the default options and a
+// TypeCache; a FileHandler may also be created directly to change them.
+type FileHandler struct {
+	// Root is the file system to serve.
+	Root FileSystem
+
+	// Dialect is the dialect gophermap files are written in.
+	Dialect GophermapDialect
+
+	// Users returns the users listed by the "~" lines of gophermaps.
+	// If nil, those lines are left out.
+	Users func() []string
+
+	// ExecCGI makes the handler run executable files as CGI scripts,
+	// as documented for CGIHandler, instead of sending them. A
+	// selector naming a path below a script runs the script, with the
+	// rest of the path as its PATH_INFO. The output of an executable
+	// gophermap is rendered as a gophermap. It requires Root to be a
+	// Dir.
+	ExecCGI bool
+
+	// CGITimeout is how long scripts may run. If zero,
+	// DefaultCGITimeout is used.
+	CGITimeout time.Duration
+
+	// Listing configures the listings of directories without a
+	// gophermap.
+	Listing ListingOptions
+
+	// Symlinks is how symbolic links are treated when Root is a Dir.
+	// By default, only those pointing within Root are followed.
+	Symlinks SymlinkPolicy
+
+	// Types detects the item types of files in listings. If nil,
+	// DefaultTypeDetector is used. It must be safe for concurrent use.
+	Types TypeDetector
+
+	// TypeCache remembers the types detected by Types. If nil, types
+	// are detected each time a directory is listed.
+	TypeCache *TypeCache
+
+	// TypeWorkers is the number of files whose types are detected at
+	// once when listing a directory. If zero, DefaultTypeWorkers is
+	// used.
+	TypeWorkers int
+}
+
+// script returns the CGIHandler running the file called name, opened
+// as file, or nil if it should not be run. Under a symlink policy
+// other than FollowSymlinks, the script is run by the path checked
+// when file was opened rather than by name, so that a link swapped in
+// since cannot escape the policy.
+func (f *FileHandler) script(name string, file File, fi os.FileInfo) *CGIHandler {
+	d, ok := f.Root.(Dir)
+	if !f.ExecCGI || !ok || !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+		return nil
+	}
+	var fullname string
+	var err error
+	if osf, ok := file.(*os.File); ok && f.Symlinks != FollowSymlinks {
+		fullname, err = openedPath(osf)
+	} else {
+		fullname, err = d.path(name)
+	}
+	if err != nil {
+		return nil
+	}
+	return &CGIHandler{Path: fullname, Root: name, Timeout: f.CGITimeout}
+}
+
+// scriptAbove returns the CGIHandler running the script that the
+// missing file called name lies below, with the rest of name as its
+// PATH_INFO, or nil if there is no such script.
+func (f *FileHandler) scriptAbove(name string) *CGIHandler {
+	if !f.ExecCGI {
+		return nil
+	}
+	for dir := path.Dir(name); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		file, err := f.open(dir)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		fi, err := file.Stat()
+		if err != nil || fi.IsDir() {
+			return nil
+		}
+		if ignored, err := f.ignored(dir, false); err != nil || ignored {
+			return nil
+		}
+		return f.script(dir, file, fi)
+	}
+	return nil
 }
 
 // FileServer returns a handler that serves Gopher requests
@@ -1160,16 +1798,24 @@ type fileHandler struct {
 //
 //     gopher.Handle("/", gopher.FileServer(gopher.Dir("/tmp")))
 func FileServer(root FileSystem) Handler {
-	return &fileHandler{root}
+	return &FileHandler{Root: root, TypeCache: NewTypeCache(DefaultTypeCacheSize)}
 }
 
-func (f *fileHandler) ServeGopher(w ResponseWriter, r *Request) {
+func (f *FileHandler) ServeGopher(w ResponseWriter, r *Request) {
 	upath := r.Selector
 	if !strings.HasPrefix(upath, "/") {
 		upath = "/" + upath
 		r.Selector = upath
 	}
-	serveFile(w, r, f.root, path.Clean(upath))
+	dir, page := f.Listing.page(upath)
+	if page > 0 {
+		// a file found at the selector of the page takes precedence
+		if file, err := f.open(path.Clean(upath)); err == nil {
+			file.Close()
+			dir, page = upath, 0
+		}
+	}
+	f.serveFile(w, r, path.Clean(dir), page)
 }
 
 // A Dir implements FileSystem using the native file system restricted to a
@@ -1189,22 +1835,30 @@ func (d Dir) Name() string {
 
 // Open opens the directory
 func (d Dir) Open(name string) (File, error) {
+	fullname, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullname)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// path returns the name of the file called name on the native file
+// system.
+func (d Dir) path(name string) (string, error) {
 	if filepath.Separator != '/' &&
 		strings.ContainsRune(name, filepath.Separator) ||
 		strings.Contains(name, "\x00") {
-		return nil, errors.New("gopher: invalid character in file path")
+		return "", errors.New("gopher: invalid character in file path")
 	}
 	dir := string(d)
 	if dir == "" {
 		dir = "."
 	}
-	f, err := os.Open(
-		filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))),
-	)
-	if err != nil {
-		return nil, err
-	}
-	return f, nil
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))), nil
 }
 
 // A FileSystem implements access to a collection of named files.
@@ -1227,107 +1881,79 @@ type File interface {
 	Stat() (os.FileInfo, error)
 }
 
-func dirList(w ResponseWriter, r *Request, f File, fs FileSystem) {
-	root := fs.Name()
-
-	fullpath := f.(*os.File).Name()
-
-	files, err := f.Readdir(-1)
+// name is '/'-separated, not filepath.Separator.
+func (f *FileHandler) serveFile(w ResponseWriter, r *Request, name string, page int) {
+	file, err := f.open(name)
 	if err != nil {
-		// TODO: log err.Error() to the Server.ErrorLog, once it's possible
-		// for a handler to get at its Server via the ResponseWriter.
-		Error(w, "Error reading directory")
+		if h := f.scriptAbove(name); h != nil {
+			h.ServeGopher(w, r)
+			return
+		}
+	}
+	if os.IsNotExist(err) {
+		NotFound(w, r)
 		return
 	}
-	sort.Sort(byName(files))
-
-	for _, file := range files {
-		if file.Name()[0] == '.' {
-			continue
-		}
-		if file.Mode()&os.ModeDir != 0 {
-			pathname, err := filepath.Rel(
-				root,
-				path.Join(fullpath, file.Name()),
-			)
-			if err != nil {
-				Error(w, "Error reading directory")
-				return
-			}
-			w.WriteItem(&Item{
-				Type:        DIRECTORY,
-				Description: file.Name(),
-				Selector:    pathname,
-				Host:        r.LocalHost,
-				Port:        r.LocalPort,
-			})
-		} else if file.Mode()&os.ModeType == 0 {
-			pathname, err := filepath.Rel(
-				root,
-				path.Join(fullpath, file.Name()),
-			)
-			if err != nil {
-				Error(w, "Error reading directory")
-				return
-			}
-
-			itemtype := GetItemType(path.Join(fullpath, file.Name()))
-
-			w.WriteItem(&Item{
-				Type:        itemtype,
-				Description: file.Name(),
-				Selector:    pathname,
-				Host:        r.LocalHost,
-				Port:        r.LocalPort,
-			})
-		}
+	if err != nil {
+		Error(w, err.Error())
+		return
 	}
-}
+	defer file.Close()
 
-type byName []os.FileInfo
-
-func (s byName) Len() int           { return len(s) }
-func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
-func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-
-// name is '/'-separated, not filepath.Separator.
-func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string) {
-	const gophermapFile = "/gophermap"
-
-	f, err := fs.Open(name)
+	d, err := file.Stat()
 	if err != nil {
 		Error(w, err.Error())
 		return
 	}
-	defer f.Close()
 
-	d, err := f.Stat()
+	ignored, err := f.ignored(name, d.IsDir())
 	if err != nil {
-		Error(w, err.Error())
+		w.Server().logf("gopher: %s of %s: %v", ignoreFile, name, err)
+		Error(w, "Error reading directory")
+		return
+	}
+	if ignored {
+		NotFound(w, r)
 		return
 	}
 
-	// use contents of gophermap for directory, if present
-	if d.IsDir() {
-		gophermap := strings.TrimSuffix(name, "/") + gophermapFile
-		ff, err := fs.Open(gophermap)
-		if err == nil {
-			defer ff.Close()
-			dd, err := ff.Stat()
-			if err == nil {
-				d = dd
-				f = ff
-			}
-		}
+	hidden, err := f.hidden(name)
+	if err != nil {
+		w.Server().logf("gopher: metadata of %s: %v", name, err)
+		Error(w, "Error reading directory")
+		return
+	}
+	if hidden {
+		NotFound(w, r)
+		return
 	}
 
-	// Still a directory? (we didn't find a gophermap file)
-	if d.IsDir() {
-		dirList(w, r, f, fs)
+	if !d.IsDir() {
+		if page > 0 {
+			NotFound(w, r)
+			return
+		}
+		if h := f.script(name, file, d); h != nil {
+			h.ServeGopher(w, r)
+			return
+		}
+		serveContent(w, r, file)
 		return
 	}
 
-	serveContent(w, r, f)
+	// use the gophermap of the directory, if present
+	g, err := f.readGophermap(r, path.Join(name, gophermapFile))
+	if os.IsNotExist(err) {
+		f.dirList(w, r, file, name, page)
+		return
+	}
+	if err == nil {
+		err = f.serveGophermap(w, r, name, g)
+	}
+	if err != nil {
+		w.Server().logf("gopher: gophermap of %s: %v", name, err)
+		Error(w, "Error reading gophermap")
+	}
 }
 
 // content must be seeked to the beginning of the file.
@@ -1338,13 +1964,13 @@ func serveContent(w ResponseWriter, r *Request, content io.ReadSeeker) {
 // Handle registers the handler for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func Handle(pattern string, handler Handler) {
-	DefaultServeMux.Handle(pattern, handler)
+func Handle(pattern string, handler Handler, opts ...RouteOption) {
+	DefaultServeMux.Handle(pattern, handler, opts...)
 }
 
 // HandleFunc registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
-	DefaultServeMux.HandleFunc(pattern, handler)
+func HandleFunc(pattern string, handler func(ResponseWriter, *Request), opts ...RouteOption) {
+	DefaultServeMux.HandleFunc(pattern, handler, opts...)
 }
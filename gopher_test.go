@@ -1,10 +1,14 @@
 package gopher_test
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,6 +74,62 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// startServer serves s on a random local port until the returned
+// function is called, and returns the address it is listening on.
+func startServer(t *testing.T, s *gopher.Server) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	go s.Serve(ln)
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+// writeTree creates a temporary directory holding files, keyed by their
+// slash-separated names, and returns it. Names ending in a slash are
+// created as empty directories. The caller removes the directory.
+func writeTree(tb testing.TB, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gopher")
+	require.NoError(tb, err)
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			require.NoError(tb, os.MkdirAll(p, 0755))
+			continue
+		}
+		require.NoError(tb, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(tb, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+	return dir
+}
+
+// recorder is a ResponseWriter that records what handlers write to it.
+type recorder struct {
+	items []*gopher.Item
+	body  bytes.Buffer
+}
+
+func (r *recorder) Server() *gopher.Server { return nil }
+func (r *recorder) End() error             { return nil }
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteError(err string) error {
+	return r.WriteItem(&gopher.Item{Type: gopher.ERROR, Description: err})
+}
+
+func (r *recorder) WriteInfo(msg string) error {
+	return r.WriteItem(&gopher.Item{Type: gopher.INFO, Description: msg})
+}
+
+func (r *recorder) WriteItem(i *gopher.Item) error {
+	r.items = append(r.items, i)
+	return nil
+}
+
 func hello(w gopher.ResponseWriter, r *gopher.Request) {
 	w.WriteInfo("Hello World!")
 }
@@ -113,14 +173,14 @@ func TestFileServer(t *testing.T) {
 
 	res, err := gopher.Get(fmt.Sprintf("gopher://%s:%d/", testHost, testPort))
 	require.NoError(err)
-	assert.Len(res.Dir.Items, 1)
+	assert.Len(res.Dir.Items, 2)
 
 	json, err := res.Dir.ToJSON()
 	require.NoError(err)
 
 	log.Println(string(json))
 	assert.JSONEq(
-		`{"items":[{"type":"0","description":"hello.txt","selector":"/hello.txt","host":"127.0.0.1","port":7000,"extras":[]}]}`,
+		`{"items":[{"type":"i","description":"","selector":"","host":"error.host","port":1,"extras":[]},{"type":"0","description":"hello.txt","selector":"/hello.txt","host":"127.0.0.1","port":7000,"extras":[]}]}`,
 		string(json))
 }
 
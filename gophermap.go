@@ -0,0 +1,259 @@
+package gopher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// gophermapFile is the name of the file FileHandler renders in place of
+// a directory listing.
+const gophermapFile = "gophermap"
+
+// maxIncludeDepth limits how deeply gophermaps may include each other.
+const maxIncludeDepth = 8
+
+// A GophermapDialect is a flavour of the gophermap format, named after
+// the server that introduced it.
+type GophermapDialect int
+
+const (
+	// Gophernicus gophermaps understand the following lines besides
+	// items and text:
+	//
+	//	# comment, left out
+	//	!title, shown as text
+	//	-name, hides name from the directory listing
+	//	=file, includes the gophermap file
+	//	~, lists the users' gopherholes
+	//	*, appends the directory listing and stops
+	//	., stops
+	Gophernicus GophermapDialect = iota
+
+	// Bucktooth gophermaps hold only items and text.
+	Bucktooth
+)
+
+// A GophermapLine is a line of a parsed gophermap: an item, a line of
+// text or a directive.
+type GophermapLine struct {
+	// Item is the item of the line, or nil. Its Selector may be
+	// relative, and its Host and Port empty, if they were left out.
+	Item *Item
+
+	// Directive is the character introducing a directive line, one
+	// of '!', '-', '=', '~' and '*', or zero.
+	Directive byte
+
+	// Text is the text of the line, or the argument of its
+	// directive.
+	Text string
+}
+
+// A Gophermap is the parsed content of a gophermap file, which
+// describes a menu in a format close to the one sent to clients. Lines
+// holding a tab are items:
+//
+//	1Phlog<TAB>phlog<TAB>host<TAB>port
+//
+// where the host and port may be left out to point at the local
+// server, and the selector to use the description as a selector. Other
+// lines are text, or directives in dialects that have them.
+type Gophermap []GophermapLine
+
+// ParseGophermap parses a gophermap written in the given dialect.
+func ParseGophermap(r io.Reader, dialect GophermapDialect) (Gophermap, error) {
+	var g Gophermap
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if strings.Contains(line, "\t") {
+			i, err := parseMenuLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("gopher: gophermap line %d: %v", n, err)
+			}
+			if i.Selector == "" && i.Type != INFO && i.Type != ERROR {
+				i.Selector = i.Description
+			}
+			g = append(g, GophermapLine{Item: i})
+			continue
+		}
+
+		if dialect == Gophernicus && line != "" {
+			switch line[0] {
+			case '#', ':':
+				continue
+			case '.':
+				if line == "." {
+					return g, nil
+				}
+			case '*':
+				return append(g, GophermapLine{Directive: '*'}), nil
+			case '!', '-', '=', '~':
+				g = append(g, GophermapLine{Directive: line[0], Text: strings.TrimSpace(line[1:])})
+				continue
+			}
+		}
+
+		g = append(g, GophermapLine{Text: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// resolveIn returns selector resolved against the directory dir.
+func resolveIn(dir, selector string) string {
+	if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "URL:") {
+		return selector
+	}
+	resolved := path.Join(dir, selector)
+	if strings.HasSuffix(selector, "/") && resolved != "/" {
+		resolved += "/"
+	}
+	return resolved
+}
+
+// Menu returns the menu described by g in reply to r, which may be nil
+// as for NewMenu, for a gophermap found in the directory dir of the
+// handler. Relative selectors are
+// resolved against dir, and items without a host point at the local
+// server. Directives that need a file system, such as "*" and "=", are
+// left out; FileHandler renders them.
+func (g Gophermap) Menu(r *Request, dir string) *Menu {
+	m := NewMenu(r)
+	g.render(m, dir, nil)
+	return m
+}
+
+// render appends the lines of g to m, calling directive for the
+// directives it doesn't handle itself.
+func (g Gophermap) render(m *Menu, dir string, directive func(GophermapLine) error) error {
+	r := m.r
+	if r == nil {
+		r = &Request{}
+	}
+	for _, l := range g {
+		switch {
+		case l.Item != nil:
+			i := *l.Item
+			if i.Host == "" && i.Port != 0 {
+				i.Host = r.LocalHost
+			}
+			if i.Host == "" && i.Type != INFO && i.Type != ERROR {
+				i.Selector = resolveIn(dir, i.Selector)
+			}
+			m.Add(&i)
+		case l.Directive == 0, l.Directive == '!':
+			m.Info(l.Text)
+		case l.Directive == '-':
+			// hidden names are collected by FileHandler
+		case directive != nil:
+			if err := directive(l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readGophermap reads and parses the gophermap called name, running it
+// if it is a script. An ignored gophermap is reported as missing.
+func (f *FileHandler) readGophermap(r *Request, name string) (Gophermap, error) {
+	file, err := f.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := f.ignored(name, fi.IsDir())
+	if err != nil {
+		return nil, err
+	}
+	if ignored {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if h := f.script(name, file, fi); h != nil {
+		var buf bytes.Buffer
+		if err := h.run(r, &buf); err != nil {
+			return nil, err
+		}
+		return ParseGophermap(&buf, f.Dialect)
+	}
+
+	return ParseGophermap(file, f.Dialect)
+}
+
+// serveGophermap replies with the gophermap g of the directory dir.
+// Nothing is written if the gophermap cannot be rendered.
+func (f *FileHandler) serveGophermap(w ResponseWriter, r *Request, dir string, g Gophermap) error {
+	hide := map[string]bool{gophermapFile: true}
+	for _, l := range g {
+		if l.Directive == '-' {
+			hide[l.Text] = true
+		}
+	}
+
+	m := NewMenu(r)
+	if err := f.renderGophermap(m, dir, g, hide, 0); err != nil {
+		return err
+	}
+	if err := m.validate(); err != nil {
+		return err
+	}
+	m.Render(w)
+	return nil
+}
+
+func (f *FileHandler) renderGophermap(m *Menu, dir string, g Gophermap, hide map[string]bool, depth int) error {
+	return g.render(m, dir, func(l GophermapLine) error {
+		switch l.Directive {
+		case '*':
+			file, err := f.open(dir)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			items, err := f.readDir(file, dir, hide)
+			if err != nil {
+				return err
+			}
+			for _, i := range items {
+				m.Add(i)
+			}
+
+		case '=':
+			if depth >= maxIncludeDepth {
+				return errors.New("gophermap includes nested too deeply")
+			}
+			name := resolveIn(dir, l.Text)
+			included, err := f.readGophermap(m.r, name)
+			if err != nil {
+				return err
+			}
+			return f.renderGophermap(m, path.Dir(name), included, hide, depth+1)
+
+		case '~':
+			if f.Users == nil {
+				return nil
+			}
+			for _, u := range f.Users() {
+				m.Dir("~"+u, "/~"+u+"/")
+			}
+		}
+		return nil
+	})
+}
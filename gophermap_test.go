@@ -0,0 +1,118 @@
+package gopher_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+const testGophermap = `!Welcome
+# a comment
+Plain text
+0About	about.txt
+1Phlog	phlog/
+0Notes	
+hFloodgap	URL:http://floodgap.com/
+1Elsewhere	/	example.org
+-secret.txt
+=footer
+~
+*
+Never shown
+`
+
+func TestParseGophermap(t *testing.T) {
+	assert := assert.New(t)
+
+	g, err := gopher.ParseGophermap(strings.NewReader(testGophermap), gopher.Gophernicus)
+	require.NoError(t, err)
+	require.Len(t, g, 11)
+
+	assert.Equal(gopher.GophermapLine{Directive: '!', Text: "Welcome"}, g[0])
+	assert.Equal(gopher.GophermapLine{Text: "Plain text"}, g[1])
+	assert.Equal(&gopher.Item{Type: gopher.FILE, Description: "About", Selector: "about.txt"}, g[2].Item)
+	assert.Equal(&gopher.Item{Type: gopher.FILE, Description: "Notes", Selector: "Notes"}, g[4].Item)
+	assert.Equal(&gopher.Item{Type: gopher.DIRECTORY, Description: "Elsewhere", Selector: "/", Host: "example.org", Port: 70}, g[6].Item)
+	assert.Equal(gopher.GophermapLine{Directive: '-', Text: "secret.txt"}, g[7])
+	assert.Equal(gopher.GophermapLine{Directive: '=', Text: "footer"}, g[8])
+	assert.Equal(gopher.GophermapLine{Directive: '~'}, g[9])
+	assert.Equal(gopher.GophermapLine{Directive: '*'}, g[10])
+
+	g, err = gopher.ParseGophermap(strings.NewReader(testGophermap), gopher.Bucktooth)
+	require.NoError(t, err)
+	require.Len(t, g, 13)
+	assert.Equal(gopher.GophermapLine{Text: "!Welcome"}, g[0])
+	assert.Equal(gopher.GophermapLine{Text: "# a comment"}, g[1])
+	assert.Equal(gopher.GophermapLine{Text: "Never shown"}, g[12])
+
+	_, err = gopher.ParseGophermap(strings.NewReader("text\n1Bad port\t/\thost\tx\n"), gopher.Gophernicus)
+	assert.EqualError(err, `gopher: gophermap line 2: invalid port "x"`)
+}
+
+func TestGophermapMenu(t *testing.T) {
+	g, err := gopher.ParseGophermap(strings.NewReader(testGophermap), gopher.Gophernicus)
+	require.NoError(t, err)
+
+	r := &gopher.Request{Selector: "/docs/", LocalHost: "localhost", LocalPort: 7070, MountPoint: "/site"}
+	d, err := g.Menu(r, "/docs").Directory()
+	require.NoError(t, err)
+
+	text, err := d.ToText()
+	require.NoError(t, err)
+	assert.Equal(t, "iWelcome\t\terror.host\t1\r\n"+
+		"iPlain text\t\terror.host\t1\r\n"+
+		"0About\t/site/docs/about.txt\tlocalhost\t7070\r\n"+
+		"1Phlog\t/site/docs/phlog/\tlocalhost\t7070\r\n"+
+		"0Notes\t/site/docs/Notes\tlocalhost\t7070\r\n"+
+		"hFloodgap\tURL:http://floodgap.com/\tlocalhost\t7070\r\n"+
+		"1Elsewhere\t/\texample.org\t70\r\n", string(text))
+
+	// without a request there is no local host to give items that
+	// have only a port, so they are reported rather than panicking
+	g, err = gopher.ParseGophermap(strings.NewReader("1Local\t/x\t\t7070\n"), gopher.Gophernicus)
+	require.NoError(t, err)
+	_, err = g.Menu(nil, "/docs").Directory()
+	assert.EqualError(t, err, `gopher: menu item 1 ("Local"): port without host`)
+}
+
+func TestFileServerGophermap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := memFS{
+		"/docs/gophermap":  testGophermap,
+		"/docs/about.txt":  "About.\n",
+		"/docs/guide.txt":  "A guide.\n",
+		"/docs/secret.txt": "Secret.\n",
+		"/docs/footer":     "Footer\n0Back home\t../\n",
+		"/loop/gophermap":  "=gophermap\n",
+	}
+	h := &gopher.FileHandler{
+		Root:  fs,
+		Users: func() []string { return []string{"ada"} },
+	}
+
+	addr, stop := startServer(t, &gopher.Server{Handler: h})
+	defer stop()
+	port := addr[strings.LastIndexByte(addr, ':')+1:]
+
+	reply := rawRequest(t, addr, "/docs\r\n")
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	require.Len(lines, 14, reply)
+
+	assert.Equal("0About\t/docs/about.txt\t127.0.0.1\t"+port, lines[2])
+	assert.Equal("iFooter\t\terror.host\t1", lines[7])
+	assert.Equal("0Back home\t/\t127.0.0.1\t"+port, lines[8])
+	assert.Equal("1~ada\t/~ada/\t127.0.0.1\t"+port, lines[9])
+	assert.Equal("0about.txt\t/docs/about.txt\t127.0.0.1\t"+port, lines[10])
+	assert.Equal("0footer\t/docs/footer\t127.0.0.1\t"+port, lines[11])
+	assert.Equal("0guide.txt\t/docs/guide.txt\t127.0.0.1\t"+port, lines[12])
+	assert.Equal(".", lines[13])
+
+	reply = rawRequest(t, addr, "/loop/\r\n")
+	assert.Equal("3Error reading gophermap\t\terror.host\t1\r\n.\r\n", reply)
+}
@@ -0,0 +1,199 @@
+package gopher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreFile is the name of the files listing the entries a FileHandler
+// leaves out, as documented for FileHandler.
+const ignoreFile = ".gopherignore"
+
+// ignoreRule is a pattern of a .gopherignore file.
+type ignoreRule struct {
+	pattern  []string // the elements of the pattern
+	negate   bool     // the pattern started with "!"
+	dirOnly  bool     // the pattern ended with "/"
+	anchored bool     // the pattern is matched against the whole path
+}
+
+// parseIgnoreRule parses a line of a .gopherignore file. It returns
+// false for blank lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	rule.pattern = strings.Split(line, "/")
+	return rule, true
+}
+
+// match reports whether the rule matches the path name, relative to
+// the directory of its .gopherignore file.
+func (rule *ignoreRule) match(name string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		ok, _ := path.Match(rule.pattern[0], path.Base(name))
+		return ok
+	}
+	return matchElems(rule.pattern, strings.Split(name, "/"))
+}
+
+// matchElems reports whether the elements of a path match those of a
+// pattern, where "**" matches any number of elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// a trailing "**" matches what is inside a directory,
+				// not the directory itself
+				return len(elems) > 0
+			}
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// ignoreList holds the rules of the .gopherignore file of dir.
+type ignoreList struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// ignoreRules are the rules applying in a directory, from those of the
+// root down to those of the directory itself.
+type ignoreRules []ignoreList
+
+// match reports whether the entry called name of the directory the
+// rules were read for is ignored. The last matching rule decides, so
+// the rules of a directory override those of its parents.
+func (rs ignoreRules) match(name string, isDir bool) bool {
+	ignored := false
+	for _, l := range rs {
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, l.dir), "/")
+		for i := range l.rules {
+			if l.rules[i].match(rel, isDir) {
+				ignored = !l.rules[i].negate
+			}
+		}
+	}
+	return ignored
+}
+
+// readIgnore adds the rules of the .gopherignore file of the directory
+// dir, if it has one, to rs.
+func (f *FileHandler) readIgnore(rs ignoreRules, dir string) (ignoreRules, error) {
+	file, err := f.open(path.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path.Join(dir, ignoreFile), err)
+	}
+	if len(rules) == 0 {
+		return rs, nil
+	}
+	return append(rs, ignoreList{dir: dir, rules: rules}), nil
+}
+
+// ignoreRules returns the rules applying to the entries of the
+// directory dir.
+func (f *FileHandler) ignoreRules(dir string) (ignoreRules, error) {
+	rs, err := f.readIgnore(nil, "/")
+	if err != nil {
+		return nil, err
+	}
+	name := "/"
+	for _, elem := range strings.Split(path.Clean("/" + dir)[1:], "/") {
+		if elem == "" {
+			break
+		}
+		name = path.Join(name, elem)
+		if rs, err = f.readIgnore(rs, name); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// ignored reports whether the file called name is ignored, either
+// itself or through one of the directories holding it. The
+// .gopherignore files themselves are always ignored, so that the
+// patterns they hide are not published.
+func (f *FileHandler) ignored(name string, isDir bool) (bool, error) {
+	if !isDir && path.Base(name) == ignoreFile {
+		return true, nil
+	}
+	rs, err := f.readIgnore(nil, "/")
+	if err != nil {
+		return false, err
+	}
+	elems := strings.Split(path.Clean("/" + name)[1:], "/")
+	dir := "/"
+	for i, elem := range elems {
+		if elem == "" {
+			break
+		}
+		last := i == len(elems)-1
+		dir = path.Join(dir, elem)
+		if rs.match(dir, isDir || !last) {
+			return true, nil
+		}
+		if !last {
+			if rs, err = f.readIgnore(rs, dir); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,93 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestFileServerIgnore(t *testing.T) {
+	fs := memFS{
+		"/.gopherignore": "# left out everywhere\n" +
+			"*.bak\n" +
+			"!keep.bak\n" +
+			"/secret/\n" +
+			"build/**\n" +
+			"docs/**/draft.txt\n",
+		"/a.txt":               "a",
+		"/a.bak":               "a",
+		"/keep.bak":            "kept",
+		"/secret/x.txt":        "x",
+		"/build/out.txt":       "out",
+		"/docs/draft.txt":      "draft",
+		"/docs/a/b/draft.txt":  "draft",
+		"/docs/a/b/final.txt":  "final",
+		"/sub/.gopherignore":   "!*.bak\nlocal.txt\n",
+		"/sub/b.bak":           "b",
+		"/sub/local.txt":       "local",
+		"/sub/secret/y.txt":    "y",
+		"/sub/deeper/c.bak":    "c",
+		"/sub/deeper/local.go": "",
+	}
+	h := gopher.FileServer(fs)
+
+	assert.Equal(t, []string{"a.txt", "build", "docs", "keep.bak", "sub"}, descriptions(listing(h, "/")))
+	assert.Equal(t, []string{"b.bak", "deeper", "secret"}, descriptions(listing(h, "/sub/")))
+	assert.Equal(t, []string{"c.bak", "local.go"}, descriptions(listing(h, "/sub/deeper/")))
+	assert.Empty(t, listing(h, "/build/"))
+
+	for _, selector := range []string{
+		"/a.bak",
+		"/secret/",
+		"/secret/x.txt",
+		"/build/out.txt",
+		"/docs/draft.txt",
+		"/docs/a/b/draft.txt",
+		"/sub/local.txt",
+		"/.gopherignore",
+		"/sub/.gopherignore",
+	} {
+		items := listing(h, selector)
+		if assert.Len(t, items, 1, selector) {
+			assert.Equal(t, gopher.Item{Type: gopher.ERROR, Description: "resource not found"}, *items[0], selector)
+		}
+	}
+
+	for selector, want := range map[string]string{
+		"/keep.bak":           "kept",
+		"/sub/b.bak":          "b",
+		"/sub/secret/y.txt":   "y",
+		"/docs/a/b/final.txt": "final",
+	} {
+		rec := &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: selector})
+		assert.Equal(t, want, rec.body.String(), selector)
+	}
+}
+
+func TestFileServerIgnoreIncludes(t *testing.T) {
+	fs := memFS{
+		"/.gopherignore":        "secret*\nmap/\n",
+		"/secret-header":        "Do not show",
+		"/secret-map":           "iDo not include\n",
+		"/notes.txt":            "notes",
+		"/menu/gophermap":       "Menu\n=../secret-map\n",
+		"/map/gophermap":        "Ignored directory\n",
+		"/public/gophermap":     "Public\n",
+		"/public/.gopherignore": "gophermap\n",
+		"/public/file.txt":      "file",
+	}
+
+	h := &gopher.FileHandler{Root: fs, Listing: gopher.ListingOptions{Header: "secret-header"}}
+	assert.Equal(t, []string{"menu", "notes.txt", "public"}, descriptions(listing(h, "/")))
+
+	items := listing(h, "/menu/")
+	require.Len(t, items, 1)
+	assert.Equal(t, gopher.ERROR, items[0].Type)
+
+	// an ignored gophermap is not rendered, and the directory is listed
+	assert.Equal(t, []string{"file.txt"}, descriptions(listing(h, "/public/")))
+}
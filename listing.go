@@ -0,0 +1,339 @@
+package gopher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A SortKey is the order of the entries of directory listings.
+type SortKey int
+
+const (
+	SortByName    SortKey = iota // by name
+	SortByModTime                // by modification time, then name
+	SortBySize                   // by size, then name
+)
+
+// DefaultListingTimeFormat is the layout of modification times in
+// directory listings when none is given.
+const DefaultListingTimeFormat = "2006-01-02 15:04"
+
+// maxNameColumn is the widest the column of names of a listing gets
+// when it is followed by other columns. Longer names are not cut.
+const maxNameColumn = 40
+
+// ListingOptions configure the directory listings of a FileHandler.
+// The zero value lists entries by ascending name, showing only their
+// names.
+type ListingOptions struct {
+	SortBy     SortKey
+	Descending bool // reverse the order of SortBy
+	DirsFirst  bool // list directories before files, whatever the order
+
+	// ShowSize and ShowModTime add the size and the modification time
+	// of entries to their descriptions, in aligned columns.
+	ShowSize    bool
+	ShowModTime bool
+
+	// TimeFormat is the layout of modification times, as used by
+	// time.Format. If empty, DefaultListingTimeFormat is used.
+	TimeFormat string
+
+	// PageSize is the number of entries on a page of a listing.
+	// Pages after the first are requested by appending ".page/N" to
+	// the selector of the directory, and linked to by "Next page" and
+	// "Previous page" items. A file actually found at such a selector
+	// is served instead. If zero, listings are not paginated.
+	PageSize int
+
+	// Header and Footer are the names of files whose text is shown
+	// above and below the listing of the directory holding them. They
+	// are left out of the listing. If empty, no file is shown.
+	Header string
+	Footer string
+}
+
+// pageSegment is the path element under which the pages of a
+// directory listing are requested, as documented for PageSize.
+const pageSegment = ".page"
+
+// page splits the page number requested with ".page/N" off selector,
+// leaving the selector of the directory. It returns zero if no page
+// was requested.
+func (o *ListingOptions) page(selector string) (string, int) {
+	if o.PageSize <= 0 {
+		return selector, 0
+	}
+	i := strings.LastIndex(selector, "/"+pageSegment+"/")
+	if i < 0 {
+		return selector, 0
+	}
+	n, err := strconv.Atoi(selector[i+len(pageSegment)+2:])
+	if err != nil || n < 1 {
+		return selector, 0
+	}
+	return selector[:i+1], n
+}
+
+// sort sorts the entries of a directory listing.
+func (o *ListingOptions) sort(files []os.FileInfo) {
+	less := func(a, b os.FileInfo) bool {
+		switch o.SortBy {
+		case SortByModTime:
+			if !a.ModTime().Equal(b.ModTime()) {
+				return a.ModTime().Before(b.ModTime())
+			}
+		case SortBySize:
+			if a.Size() != b.Size() {
+				return a.Size() < b.Size()
+			}
+		}
+		return a.Name() < b.Name()
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if o.DirsFirst && a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		if o.Descending {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+// describe returns the descriptions of files, whose titles are the
+// names shown, with their columns aligned.
+func (o *ListingOptions) describe(files []os.FileInfo, titles []string) []string {
+	if !o.ShowSize && !o.ShowModTime {
+		return titles
+	}
+
+	width := 0
+	for _, title := range titles {
+		if n := utf8.RuneCountInString(title); n > width {
+			width = n
+		}
+	}
+	if width > maxNameColumn {
+		width = maxNameColumn
+	}
+
+	layout := o.TimeFormat
+	if layout == "" {
+		layout = DefaultListingTimeFormat
+	}
+
+	descs := make([]string, len(files))
+	for i, fi := range files {
+		desc := titles[i]
+		if pad := width - utf8.RuneCountInString(desc); pad > 0 {
+			desc += strings.Repeat(" ", pad)
+		}
+		if o.ShowSize {
+			size := "-"
+			if !fi.IsDir() {
+				size = formatSize(fi.Size())
+			}
+			desc += fmt.Sprintf("  %6s", size)
+		}
+		if o.ShowModTime {
+			desc += "  " + fi.ModTime().Format(layout)
+		}
+		descs[i] = desc
+	}
+	return descs
+}
+
+// formatSize formats a size in bytes for humans, such as "1.5K".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// readDir returns the items listing the directory file, called name,
+// leaving out hidden and ignored files, the names in hide and the names
+// that cannot be written in a menu. Symbolic links are listed as their
+// targets, if the symlink policy of f lets them be followed. Items
+// point at the local server, unless the metadata of the directory says
+// otherwise.
+func (f *FileHandler) readDir(file File, name string, hide map[string]bool) ([]*Item, error) {
+	all, err := file.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := f.readMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := f.ignoreRules(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	for _, fi := range all {
+		if fi.Name()[0] == '.' || hide[fi.Name()] {
+			continue
+		}
+		if m := meta[fi.Name()]; m != nil && m.Hidden {
+			continue
+		}
+		if strings.ContainsAny(fi.Name(), "\t\r\n") {
+			continue // cannot be written in a menu
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if fi = f.stat(path.Join(name, fi.Name())); fi == nil {
+				continue
+			}
+		}
+		if fi.Mode()&os.ModeType != 0 && !fi.IsDir() {
+			continue
+		}
+		if ignore.match(path.Join(name, fi.Name()), fi.IsDir()) {
+			continue
+		}
+		files = append(files, fi)
+	}
+	f.Listing.sort(files)
+
+	titles := make([]string, len(files))
+	for i, fi := range files {
+		titles[i] = fi.Name()
+		if m := meta[fi.Name()]; m != nil && m.Description != "" {
+			titles[i] = lineEscaper.Replace(m.Description)
+		}
+	}
+
+	items := make([]*Item, len(files))
+	names := make([]string, len(files))
+	for i, desc := range f.Listing.describe(files, titles) {
+		names[i] = path.Join(name, files[i].Name())
+		items[i] = &Item{
+			Description: desc,
+			Selector:    names[i],
+		}
+		if m := meta[files[i].Name()]; m != nil {
+			m.apply(items[i], name)
+		}
+	}
+	f.detectTypes(items, names, files)
+	return items, nil
+}
+
+// stat returns the FileInfo of the file called name, following
+// symbolic links, or nil if it cannot be opened.
+func (f *FileHandler) stat(name string) os.FileInfo {
+	file, err := f.open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	return fi
+}
+
+// dirList lists the directory file, called name. Page is the page of
+// the listing requested, or zero.
+func (f *FileHandler) dirList(w ResponseWriter, r *Request, file File, name string, page int) {
+	o := &f.Listing
+	hide := make(map[string]bool)
+	for _, filename := range []string{o.Header, o.Footer} {
+		if filename != "" {
+			hide[filename] = true
+		}
+	}
+
+	items, err := f.readDir(file, name, hide)
+	if err != nil {
+		w.Server().logf("gopher: reading directory %s: %v", name, err)
+		Error(w, "Error reading directory")
+		return
+	}
+
+	pages := 1
+	if o.PageSize > 0 && len(items) > o.PageSize {
+		pages = (len(items) + o.PageSize - 1) / o.PageSize
+	}
+	if page == 0 {
+		page = 1
+	}
+	if page > pages {
+		Error(w, "No such page")
+		return
+	}
+	if pages > 1 {
+		end := page * o.PageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		items = items[(page-1)*o.PageSize : end]
+	}
+
+	m := NewMenu(r)
+	f.infoFile(m, name, o.Header)
+	for _, i := range items {
+		m.Add(i)
+	}
+	if pages > 1 {
+		dir := strings.TrimSuffix(name, "/") + "/"
+		m.Blank().Info(fmt.Sprintf("Page %d of %d", page, pages))
+		if page > 1 {
+			prev := dir
+			if page > 2 {
+				prev += pageSegment + "/" + strconv.Itoa(page-1)
+			}
+			m.Dir("Previous page", prev)
+		}
+		if page < pages {
+			m.Dir("Next page", dir+pageSegment+"/"+strconv.Itoa(page+1))
+		}
+	}
+	f.infoFile(m, name, o.Footer)
+
+	if err := m.Render(w); err != nil {
+		w.Server().logf("gopher: listing directory %s: %v", name, err)
+	}
+}
+
+// infoFile adds the text of the file called filename in the directory
+// dir to m, if there is such a file and it isn't ignored.
+func (f *FileHandler) infoFile(m *Menu, dir, filename string) {
+	if filename == "" {
+		return
+	}
+	name := path.Join(dir, filename)
+	if ignored, err := f.ignored(name, false); err != nil || ignored {
+		return
+	}
+	file, err := f.open(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return
+	}
+	m.Info(strings.Replace(string(b), "\t", "        ", -1))
+}
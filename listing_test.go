@@ -0,0 +1,150 @@
+package gopher_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// listingDir creates a directory with files of known sizes and
+// modification times.
+func listingDir(t *testing.T) string {
+	files := []struct {
+		name string
+		size int
+		age  int
+	}{
+		{"b.txt", 10, 1},
+		{"a.txt", 3000, 3},
+		{"c.txt", 200, 2},
+		{"HEADER", 12, 0},
+	}
+	tree := map[string]string{"zdir/": ""}
+	for _, f := range files {
+		tree[f.name] = strings.Repeat("x", f.size)
+	}
+	dir := writeTree(t, tree)
+
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	for _, f := range files {
+		mtime := base.Add(-time.Duration(f.age) * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, f.name), mtime, mtime))
+	}
+	return dir
+}
+
+func listing(h gopher.Handler, selector string) []*gopher.Item {
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: selector})
+	return rec.items
+}
+
+func descriptions(items []*gopher.Item) []string {
+	descs := make([]string, len(items))
+	for i, item := range items {
+		descs[i] = item.Description
+	}
+	return descs
+}
+
+func TestFileServerListingSort(t *testing.T) {
+	dir := listingDir(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		options gopher.ListingOptions
+		want    []string
+	}{
+		{gopher.ListingOptions{}, []string{"HEADER", "a.txt", "b.txt", "c.txt", "zdir"}},
+		{gopher.ListingOptions{Descending: true}, []string{"zdir", "c.txt", "b.txt", "a.txt", "HEADER"}},
+		{gopher.ListingOptions{DirsFirst: true, Descending: true}, []string{"zdir", "c.txt", "b.txt", "a.txt", "HEADER"}},
+		{gopher.ListingOptions{SortBy: gopher.SortBySize, DirsFirst: true}, []string{"zdir", "b.txt", "HEADER", "c.txt", "a.txt"}},
+		{gopher.ListingOptions{SortBy: gopher.SortByModTime, Header: "HEADER"}, []string{"xxxxxxxxxxxx", "a.txt", "c.txt", "b.txt", "zdir"}},
+	}
+
+	for _, tt := range tests {
+		h := &gopher.FileHandler{Root: gopher.Dir(dir), Listing: tt.options}
+		assert.Equal(t, tt.want, descriptions(listing(h, "/")), "%+v", tt.options)
+	}
+}
+
+func TestFileServerListingColumns(t *testing.T) {
+	dir := listingDir(t)
+	defer os.RemoveAll(dir)
+
+	h := &gopher.FileHandler{Root: gopher.Dir(dir), Listing: gopher.ListingOptions{
+		ShowSize:    true,
+		ShowModTime: true,
+		TimeFormat:  "Jan _2 15:04",
+		Footer:      "HEADER",
+	}}
+	items := listing(h, "/")
+	require.Len(t, items, 5)
+
+	assert.Equal(t, "a.txt    2.9K  Jan  1 09:00", items[0].Description)
+	assert.Equal(t, "b.txt      10  Jan  1 11:00", items[1].Description)
+	assert.Equal(t, "c.txt     200  Jan  1 10:00", items[2].Description)
+	assert.True(t, strings.HasPrefix(items[3].Description, "zdir        -  "), items[3].Description)
+	assert.Equal(t, "xxxxxxxxxxxx", items[4].Description)
+}
+
+func TestFileServerListingPages(t *testing.T) {
+	dir := listingDir(t)
+	defer os.RemoveAll(dir)
+
+	mux := gopher.NewServeMux()
+	mux.Mount("/files", &gopher.FileHandler{Root: gopher.Dir(dir), Listing: gopher.ListingOptions{PageSize: 2}})
+
+	items := listing(mux, "/files/")
+	assert.Equal(t, []string{"HEADER", "a.txt", "", "Page 1 of 3", "Next page"}, descriptions(items))
+	assert.Equal(t, "/files/.page/2", items[4].Selector)
+
+	items = listing(mux, "/files/.page/2")
+	assert.Equal(t, []string{"b.txt", "c.txt", "", "Page 2 of 3", "Previous page", "Next page"}, descriptions(items))
+	assert.Equal(t, "/files/", items[4].Selector)
+	assert.Equal(t, "/files/.page/3", items[5].Selector)
+
+	items = listing(mux, "/files/.page/3")
+	assert.Equal(t, []string{"zdir", "", "Page 3 of 3", "Previous page"}, descriptions(items))
+	assert.Equal(t, "/files/.page/2", items[3].Selector)
+
+	items = listing(mux, "/files/.page/4")
+	require.Len(t, items, 1)
+	assert.Equal(t, gopher.ERROR, items[0].Type)
+
+	items = listing(mux, "/files/a.txt/.page/2")
+	require.Len(t, items, 1)
+	assert.Equal(t, gopher.ERROR, items[0].Type)
+}
+
+func TestFileServerListingPageNames(t *testing.T) {
+	fs := memFS{
+		"/notes?page=2": "question",
+		"/sub/.page/2":  "real",
+	}
+	for c := 'a'; c <= 'u'; c++ {
+		fs["/sub/"+string(c)+".txt"] = string(c)
+	}
+	h := &gopher.FileHandler{Root: fs, Listing: gopher.ListingOptions{PageSize: 10}}
+
+	// selectors that look like pages still reach real files
+	for selector, want := range map[string]string{
+		"/notes?page=2": "question",
+		"/sub/.page/2":  "real",
+	} {
+		rec := &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: selector})
+		assert.Equal(t, want, rec.body.String(), selector)
+	}
+
+	items := listing(h, "/sub/.page/3")
+	assert.Equal(t, []string{"u.txt", "", "Page 3 of 3", "Previous page"}, descriptions(items))
+	assert.Equal(t, "/sub/.page/2", items[3].Selector)
+}
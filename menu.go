@@ -0,0 +1,244 @@
+package gopher
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// A Menu builds a menu in reply to a request, one item at a time:
+//
+//	gopher.NewMenu(r).
+//		Info("Welcome to my hole").
+//		Blank().
+//		Dir("Phlog", "phlog/").
+//		Text("About me", "about.txt").
+//		Search("Search", "search").
+//		Dir("Floodgap", "/").At("gopher.floodgap.com", 70).
+//		HTML("My website", "https://example.com/").
+//		Render(w)
+//
+// Items without a host point at the local server, and their selectors
+// are relative to the root of the handler, which is the request's
+// mount point for handlers mounted with StripPrefix, whether or not
+// they begin with a slash. To link elsewhere on the local server, such
+// as to its root, give the item the local host and port with At.
+//
+// Building a menu never fails; fields that cannot be written in a menu,
+// such as descriptions containing tabs, are reported when the menu is
+// rendered.
+type Menu struct {
+	r     *Request
+	items []*Item
+}
+
+// NewMenu returns an empty menu replying to r. If r is nil, the menu
+// replies to a local request that isn't mounted anywhere.
+func NewMenu(r *Request) *Menu {
+	return &Menu{r: r}
+}
+
+// Add appends a copy of i to the menu.
+func (m *Menu) Add(i *Item) *Menu {
+	item := *i
+	m.items = append(m.items, &item)
+	return m
+}
+
+func (m *Menu) add(t ItemType, description, selector string) *Menu {
+	return m.Add(&Item{Type: t, Description: description, Selector: selector})
+}
+
+// Info appends informational text to the menu, one item per line.
+func (m *Menu) Info(text string) *Menu {
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		m.add(INFO, strings.TrimSuffix(line, "\r"), "")
+	}
+	return m
+}
+
+// Blank appends an empty line to the menu.
+func (m *Menu) Blank() *Menu {
+	return m.add(INFO, "", "")
+}
+
+// Error appends an error item to the menu.
+func (m *Menu) Error(msg string) *Menu {
+	return m.add(ERROR, msg, "")
+}
+
+// Text appends a link to a text file.
+func (m *Menu) Text(description, selector string) *Menu {
+	return m.add(FILE, description, selector)
+}
+
+// Dir appends a link to a menu.
+func (m *Menu) Dir(description, selector string) *Menu {
+	return m.add(DIRECTORY, description, selector)
+}
+
+// Search appends a link to a search server.
+func (m *Menu) Search(description, selector string) *Menu {
+	return m.add(INDEXSEARCH, description, selector)
+}
+
+// HTML appends a link to a web page, using the "URL:" selector
+// convention understood by most clients.
+func (m *Menu) HTML(description, rawurl string) *Menu {
+	return m.add(HTML, description, "URL:"+rawurl)
+}
+
+// Link appends a link to rawurl. Gopher URLs link to the item they
+// name, such as "gopher://gopher.floodgap.com/1/world"; other URLs are
+// linked as web pages by HTML.
+func (m *Menu) Link(description, rawurl string) *Menu {
+	return m.Add(linkItem(description, rawurl))
+}
+
+// linkItem returns the item linking to rawurl, as described for
+// Menu.Link.
+func linkItem(description, rawurl string) *Item {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "gopher" {
+		return &Item{Type: HTML, Description: description, Selector: "URL:" + rawurl}
+	}
+
+	i := &Item{Type: DIRECTORY, Description: description, Host: u.Hostname(), Port: 70}
+	if p := u.Port(); p != "" {
+		i.Port, _ = strconv.Atoi(p)
+	}
+	if sel := strings.TrimPrefix(u.Path, "/"); sel != "" {
+		i.Type, i.Selector = ItemType(sel[0]), sel[1:]
+	}
+	return i
+}
+
+// At makes the last item of the menu point at the given server instead
+// of the local one. A zero port means 70.
+func (m *Menu) At(host string, port int) *Menu {
+	if len(m.items) == 0 {
+		return m
+	}
+	if port == 0 {
+		port = 70
+	}
+	i := m.items[len(m.items)-1]
+	i.Host, i.Port = host, port
+	return m
+}
+
+// Len returns the number of items in the menu.
+func (m *Menu) Len() int {
+	return len(m.items)
+}
+
+// validate reports the first item of the menu that cannot be written.
+func (m *Menu) validate() error {
+	for n, i := range m.items {
+		var err error
+		switch {
+		case i.Type == 0:
+			err = errors.New("missing item type")
+		case strings.ContainsAny(i.Description, "\t\r\n"):
+			err = errors.New("description contains a tab or newline")
+		case strings.ContainsAny(i.Selector, "\t\r\n"):
+			err = errors.New("selector contains a tab or newline")
+		case strings.ContainsAny(i.Host, "\t\r\n"):
+			err = errors.New("host contains a tab or newline")
+		case i.Port < 0 || i.Port > 65535:
+			err = fmt.Errorf("invalid port %d", i.Port)
+		case i.Host == "" && i.Port != 0:
+			err = errors.New("port without host")
+		}
+		if err != nil {
+			return fmt.Errorf("gopher: menu item %d (%q): %v", n+1, i.Description, err)
+		}
+	}
+	return nil
+}
+
+// resolve returns the selector of a local item relative to the root of
+// the handler.
+func resolve(selector string) string {
+	if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "URL:") {
+		return selector
+	}
+	return cleanPath(selector)
+}
+
+// Render writes the menu to w, which must be replying to the request
+// the menu was created for. Nothing is written if the menu is invalid.
+func (m *Menu) Render(w ResponseWriter) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	for _, i := range m.items {
+		var err error
+		switch {
+		case i.Type == INFO && i.Host == "":
+			err = w.WriteInfo(i.Description)
+		case i.Type == ERROR && i.Host == "":
+			err = w.WriteError(i.Description)
+		default:
+			item := *i
+			if item.Host == "" {
+				item.Selector = resolve(item.Selector)
+			}
+			err = w.WriteItem(&item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Directory returns the items of the menu as seen from outside the
+// handler: local selectors include the request's mount point, and local
+// items point at the address the request arrived on. Without a request,
+// local items are left without a host.
+func (m *Menu) Directory() (Directory, error) {
+	if err := m.validate(); err != nil {
+		return Directory{}, err
+	}
+	r := m.r
+	if r == nil {
+		r = &Request{}
+	}
+
+	d := Directory{Items: make([]*Item, 0, len(m.items))}
+	for _, i := range m.items {
+		item := *i
+		switch {
+		case item.Type == INFO || item.Type == ERROR:
+			if item.Host == "" {
+				item.Host, item.Port = "error.host", 1
+			}
+		case item.Host == "":
+			item.Selector = resolve(item.Selector)
+			if strings.HasPrefix(item.Selector, "/") {
+				item.Selector = r.MountPoint + item.Selector
+			}
+			item.Host, item.Port = r.LocalHost, r.LocalPort
+		}
+		d.Items = append(d.Items, &item)
+	}
+	return d, nil
+}
+
+// MarshalText returns the menu as it is sent to clients, including the
+// terminating line.
+func (m *Menu) MarshalText() ([]byte, error) {
+	d, err := m.Directory()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.ToText()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, END, '\r', '\n'), nil
+}
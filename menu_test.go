@@ -0,0 +1,126 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestMenuRender(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := &gopher.Request{Selector: "/"}
+	rec := &recorder{}
+	err := gopher.NewMenu(r).
+		Info("Welcome\nto my hole").
+		Blank().
+		Dir("Phlog", "phlog/").
+		Text("About", "/about.txt").
+		Search("Search", "search").
+		Dir("Floodgap", "/").At("gopher.floodgap.com", 0).
+		Link("World", "gopher://gopher.floodgap.com:7070/1/world").
+		Link("Website", "https://example.com/").
+		Error("oops").
+		Render(rec)
+	require.NoError(err)
+	require.Len(rec.items, 10)
+
+	assert.Equal("Welcome", rec.items[0].Description)
+	assert.Equal("to my hole", rec.items[1].Description)
+	assert.Equal("", rec.items[2].Description)
+
+	assert.Equal(gopher.DIRECTORY, rec.items[3].Type)
+	assert.Equal("/phlog/", rec.items[3].Selector)
+	assert.Equal("", rec.items[3].Host)
+	assert.Equal("/about.txt", rec.items[4].Selector)
+	assert.Equal(gopher.INDEXSEARCH, rec.items[5].Type)
+	assert.Equal("/search", rec.items[5].Selector)
+
+	assert.Equal("gopher.floodgap.com", rec.items[6].Host)
+	assert.Equal(70, rec.items[6].Port)
+	assert.Equal("/", rec.items[6].Selector)
+
+	assert.Equal(gopher.DIRECTORY, rec.items[7].Type)
+	assert.Equal("/world", rec.items[7].Selector)
+	assert.Equal(7070, rec.items[7].Port)
+
+	assert.Equal(gopher.HTML, rec.items[8].Type)
+	assert.Equal("URL:https://example.com/", rec.items[8].Selector)
+
+	assert.Equal(gopher.ERROR, rec.items[9].Type)
+	assert.Equal("oops", rec.items[9].Description)
+}
+
+func TestMenuInvalid(t *testing.T) {
+	tests := []*gopher.Menu{
+		gopher.NewMenu(nil).Dir("a\tb", "/"),
+		gopher.NewMenu(nil).Text("a", "/a\r\nb"),
+		gopher.NewMenu(nil).Add(&gopher.Item{Description: "untyped"}),
+		gopher.NewMenu(nil).Dir("far", "/").At("example.org", 100000),
+		gopher.NewMenu(nil).Add(&gopher.Item{Type: gopher.FILE, Port: 70}),
+		gopher.NewMenu(nil).Link("empty", "gopher:///1/"),
+	}
+
+	for _, m := range tests {
+		rec := &recorder{}
+		assert.Error(t, m.Render(rec))
+		assert.Empty(t, rec.items)
+
+		_, err := m.MarshalText()
+		assert.Error(t, err)
+	}
+}
+
+func TestMenuMounted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var text []byte
+	mux := gopher.NewServeMux()
+	mux.Mount("/blog", gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		m := gopher.NewMenu(r).Dir("Posts", "posts/").Text("Feed", "/feed.xml").
+			Dir("Home", "/").At(r.LocalHost, r.LocalPort)
+		var err error
+		text, err = m.MarshalText()
+		require.NoError(err)
+		require.NoError(m.Render(w))
+	}))
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/blog/", LocalHost: "localhost", LocalPort: 7000})
+	require.Len(rec.items, 3)
+	assert.Equal("/blog/posts/", rec.items[0].Selector)
+	assert.Equal("/blog/feed.xml", rec.items[1].Selector)
+	assert.Equal("/", rec.items[2].Selector)
+
+	assert.Equal("1Posts\t/blog/posts/\tlocalhost\t7000\r\n"+
+		"0Feed\t/blog/feed.xml\tlocalhost\t7000\r\n"+
+		"1Home\t/\tlocalhost\t7000\r\n.\r\n", string(text))
+}
+
+func TestMenuWithoutRequest(t *testing.T) {
+	m := gopher.NewMenu(nil).Info("Hello").Dir("Posts", "posts/").Text("Far", "/far.txt").At("example.org", 0)
+
+	d, err := m.Directory()
+	require.NoError(t, err)
+	require.Len(t, d.Items, 3)
+	assert.Equal(t, gopher.Item{Type: gopher.INFO, Description: "Hello", Host: "error.host", Port: 1}, *d.Items[0])
+	assert.Equal(t, gopher.Item{Type: gopher.DIRECTORY, Description: "Posts", Selector: "/posts/"}, *d.Items[1])
+	assert.Equal(t, gopher.Item{Type: gopher.FILE, Description: "Far", Selector: "/far.txt", Host: "example.org", Port: 70}, *d.Items[2])
+}
+
+func TestMenuServer(t *testing.T) {
+	addr, stop := startServer(t, &gopher.Server{
+		Handler: gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+			gopher.NewMenu(r).Info("hi").Dir("Home", "").Render(w)
+		}),
+	})
+	defer stop()
+
+	reply := rawRequest(t, addr, "/\r\n")
+	assert.Equal(t, "ihi\t\terror.host\t1\r\n1Home\t/\t127.0.0.1\t"+addr[len("127.0.0.1:"):]+"\r\n.\r\n", reply)
+}
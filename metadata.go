@@ -0,0 +1,115 @@
+package gopher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// The sidecar files holding the metadata of the entries of a
+// directory, as documented for FileHandler. Where both describe an
+// entry, .gopher.json takes precedence.
+const (
+	descFile = ".gopherdesc"
+	metaFile = ".gopher.json"
+)
+
+// fileMeta is the metadata of a directory entry.
+type fileMeta struct {
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Hidden      bool   `json:"hidden"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Selector    string `json:"selector"`
+}
+
+// readMeta reads the metadata of the entries of the directory dir. It
+// returns nil if the directory has no sidecar files.
+func (f *FileHandler) readMeta(dir string) (map[string]*fileMeta, error) {
+	var meta map[string]*fileMeta
+
+	if file, err := f.open(path.Join(dir, descFile)); err == nil {
+		meta = make(map[string]*fileMeta)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			i := strings.IndexByte(line, '\t')
+			if line == "" || line[0] == '#' || i < 0 {
+				continue
+			}
+			meta[line[:i]] = &fileMeta{Description: strings.TrimSpace(line[i+1:])}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", descFile, err)
+		}
+	}
+
+	if file, err := f.open(path.Join(dir, metaFile)); err == nil {
+		var entries map[string]*fileMeta
+		err = json.NewDecoder(file).Decode(&entries)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", metaFile, err)
+		}
+		for name, m := range entries {
+			if m == nil {
+				continue
+			}
+			if len(m.Type) > 1 {
+				return nil, fmt.Errorf("%s: %s: invalid item type %q", metaFile, name, m.Type)
+			}
+			if meta == nil {
+				meta = make(map[string]*fileMeta)
+			}
+			if m.Description == "" && meta[name] != nil {
+				m.Description = meta[name].Description
+			}
+			meta[name] = m
+		}
+	}
+
+	return meta, nil
+}
+
+// hidden reports whether the file called name is left out by the
+// metadata of its directory. The sidecar files themselves are always
+// hidden, so that the entries they hide are not published.
+func (f *FileHandler) hidden(name string) (bool, error) {
+	dir, base := path.Split(path.Clean("/" + name))
+	if base == descFile || base == metaFile {
+		return true, nil
+	}
+	if base == "" {
+		return false, nil
+	}
+	meta, err := f.readMeta(dir)
+	if err != nil {
+		return false, err
+	}
+	m := meta[base]
+	return m != nil && m.Hidden, nil
+}
+
+// apply applies the metadata m to the item i listing an entry of the
+// directory dir.
+func (m *fileMeta) apply(i *Item, dir string) {
+	if m.Type != "" {
+		i.Type = ItemType(m.Type[0])
+	}
+	if m.Host != "" {
+		i.Host, i.Port = m.Host, m.Port
+		if i.Port == 0 {
+			i.Port = 70
+		}
+		i.Selector = m.Selector
+		return
+	}
+	if m.Selector != "" {
+		i.Selector = resolveIn(dir, m.Selector)
+	}
+}
@@ -0,0 +1,56 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestFileServerMetadata(t *testing.T) {
+	fs := memFS{
+		"/docs/.gopherdesc": "# descriptions\n" +
+			"guide.txt\tThe user guide\n" +
+			"notes.txt\tOverridden below\n" +
+			"malformed line\n",
+		"/docs/.gopher.json": `{
+			"notes.txt": {"type": "1"},
+			"draft.txt": {"hidden": true},
+			"floodgap": {"description": "Floodgap", "type": "1", "host": "gopher.floodgap.com", "selector": "/"},
+			"alias.txt": {"selector": "guide.txt"}
+		}`,
+		"/docs/guide.txt":    "A guide.\n",
+		"/docs/notes.txt":    "Notes.\n",
+		"/docs/draft.txt":    "Not yet.\n",
+		"/docs/floodgap":     "",
+		"/docs/alias.txt":    "",
+		"/docs/unlisted.txt": "Plain.\n",
+	}
+
+	items := listing(gopher.FileServer(fs), "/docs/")
+	require.Len(t, items, 5)
+
+	assert.Equal(t, gopher.Item{Type: gopher.FILE, Description: "alias.txt", Selector: "/docs/guide.txt"}, *items[0])
+	assert.Equal(t, gopher.Item{Type: gopher.DIRECTORY, Description: "Floodgap", Selector: "/", Host: "gopher.floodgap.com", Port: 70}, *items[1])
+	assert.Equal(t, gopher.Item{Type: gopher.FILE, Description: "The user guide", Selector: "/docs/guide.txt"}, *items[2])
+	assert.Equal(t, gopher.Item{Type: gopher.DIRECTORY, Description: "Overridden below", Selector: "/docs/notes.txt"}, *items[3])
+	assert.Equal(t, gopher.Item{Type: gopher.FILE, Description: "unlisted.txt", Selector: "/docs/unlisted.txt"}, *items[4])
+
+	// hidden entries and the sidecar files are answered as missing
+	for _, selector := range []string{"/docs/draft.txt", "/docs/.gopher.json", "/docs/.gopherdesc"} {
+		items := listing(gopher.FileServer(fs), selector)
+		if assert.Len(t, items, 1, selector) {
+			assert.Equal(t, gopher.Item{Type: gopher.ERROR, Description: "resource not found"}, *items[0], selector)
+		}
+	}
+	rec := &recorder{}
+	gopher.FileServer(fs).ServeGopher(rec, &gopher.Request{Selector: "/docs/guide.txt"})
+	assert.Equal(t, "A guide.\n", rec.body.String())
+
+	fs["/docs/.gopher.json"] = `{"notes.txt": {"type": "10"}}`
+	items = listing(gopher.FileServer(fs), "/docs/")
+	require.Len(t, items, 1)
+	assert.Equal(t, gopher.ERROR, items[0].Type)
+}
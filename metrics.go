@@ -0,0 +1,228 @@
+package gopher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+// DefaultLatencyBuckets are the default upper bounds, in seconds, of the
+// request latency histogram.
+var DefaultLatencyBuckets = []float64{
+	.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+// Metrics collects request and connection statistics of a Server and
+// exposes them in the Prometheus text exposition format.
+//
+// Requests are labelled with the ServeMux pattern that matched them, so
+// a Server whose Handler is not a ServeMux reports every request under
+// the empty pattern.
+//
+// Metrics implements both Handler and http.Handler, so the same
+// statistics may be scraped over HTTP or browsed as a text document:
+//
+//	metrics := gopher.NewMetrics()
+//	gopher.Handle("/metrics", metrics)
+//	go http.ListenAndServe(":9070", metrics)
+//	server := &gopher.Server{Addr: ":70", Metrics: metrics}
+type Metrics struct {
+	mu sync.Mutex
+
+	buckets []float64
+
+	requests map[requestLabels]uint64
+	patterns map[string]*patternMetrics
+
+	activeConns  int64
+	acceptErrors uint64
+}
+
+type requestLabels struct {
+	pattern string
+	kind    ResponseKind
+}
+
+type patternMetrics struct {
+	errorItems uint64
+	bytes      uint64
+
+	counts []uint64 // cumulative per bucket, plus +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewMetrics allocates and returns a new Metrics using
+// DefaultLatencyBuckets for the latency histogram.
+func NewMetrics() *Metrics {
+	return NewMetricsWithBuckets(DefaultLatencyBuckets)
+}
+
+// NewMetricsWithBuckets allocates and returns a new Metrics whose
+// latency histogram uses the given upper bounds, in seconds.
+func NewMetricsWithBuckets(buckets []float64) *Metrics {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Metrics{
+		buckets:  b,
+		requests: make(map[requestLabels]uint64),
+		patterns: make(map[string]*patternMetrics),
+	}
+}
+
+func (m *Metrics) connOpened() {
+	m.mu.Lock()
+	m.activeConns++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) connClosed() {
+	m.mu.Lock()
+	m.activeConns--
+	m.mu.Unlock()
+}
+
+func (m *Metrics) acceptError() {
+	m.mu.Lock()
+	m.acceptErrors++
+	m.mu.Unlock()
+}
+
+// observe records a finished response.
+func (m *Metrics) observe(w *response, start time.Time) {
+	m.Observe(w.req.Pattern, w.rt, w.errors, w.bytes, time.Since(start))
+}
+
+// Observe records a single request served under pattern. It is called
+// by Server for every request and is exported for handlers that serve
+// requests outside of a Server, such as proxies.
+func (m *Metrics) Observe(pattern string, kind ResponseKind, errorItems int, bytes int64, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{pattern, kind}]++
+
+	p, ok := m.patterns[pattern]
+	if !ok {
+		p = &patternMetrics{counts: make([]uint64, len(m.buckets)+1)}
+		m.patterns[pattern] = p
+	}
+	p.errorItems += uint64(errorItems)
+	p.bytes += uint64(bytes)
+
+	seconds := d.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			p.counts[i]++
+		}
+	}
+	p.counts[len(m.buckets)]++
+	p.sum += seconds
+	p.count++
+}
+
+// WriteTo writes all metrics to w in the Prometheus text exposition
+// format. Series are sorted by their labels so output is stable.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	m.mu.Lock()
+
+	requests := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		requests = append(requests, k)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].pattern != requests[j].pattern {
+			return requests[i].pattern < requests[j].pattern
+		}
+		return requests[i].kind < requests[j].kind
+	})
+
+	patterns := make([]string, 0, len(m.patterns))
+	for k := range m.patterns {
+		patterns = append(patterns, k)
+	}
+	sort.Strings(patterns)
+
+	writeHeader(&buf, "gopher_requests_total", "counter",
+		"Total number of requests by matched pattern and response kind.")
+	for _, k := range requests {
+		fmt.Fprintf(&buf, "gopher_requests_total{pattern=%s,kind=%s} %d\n",
+			quoteLabel(k.pattern), quoteLabel(k.kind.String()), m.requests[k])
+	}
+
+	writeHeader(&buf, "gopher_error_items_total", "counter",
+		"Total number of error items written by matched pattern.")
+	for _, k := range patterns {
+		fmt.Fprintf(&buf, "gopher_error_items_total{pattern=%s} %d\n",
+			quoteLabel(k), m.patterns[k].errorItems)
+	}
+
+	writeHeader(&buf, "gopher_response_bytes_total", "counter",
+		"Total number of response bytes written by matched pattern.")
+	for _, k := range patterns {
+		fmt.Fprintf(&buf, "gopher_response_bytes_total{pattern=%s} %d\n",
+			quoteLabel(k), m.patterns[k].bytes)
+	}
+
+	writeHeader(&buf, "gopher_request_duration_seconds", "histogram",
+		"Time taken to serve requests by matched pattern.")
+	for _, k := range patterns {
+		p := m.patterns[k]
+		for i, le := range m.buckets {
+			fmt.Fprintf(&buf, "gopher_request_duration_seconds_bucket{pattern=%s,le=%s} %d\n",
+				quoteLabel(k), quoteLabel(formatFloat(le)), p.counts[i])
+		}
+		fmt.Fprintf(&buf, "gopher_request_duration_seconds_bucket{pattern=%s,le=\"+Inf\"} %d\n",
+			quoteLabel(k), p.counts[len(m.buckets)])
+		fmt.Fprintf(&buf, "gopher_request_duration_seconds_sum{pattern=%s} %s\n",
+			quoteLabel(k), formatFloat(p.sum))
+		fmt.Fprintf(&buf, "gopher_request_duration_seconds_count{pattern=%s} %d\n",
+			quoteLabel(k), p.count)
+	}
+
+	writeHeader(&buf, "gopher_active_connections", "gauge",
+		"Number of connections currently being served.")
+	fmt.Fprintf(&buf, "gopher_active_connections %d\n", m.activeConns)
+
+	writeHeader(&buf, "gopher_accept_errors_total", "counter",
+		"Total number of errors accepting new connections.")
+	fmt.Fprintf(&buf, "gopher_accept_errors_total %d\n", m.acceptErrors)
+
+	m.mu.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+// ServeGopher writes the metrics as a text document.
+func (m *Metrics) ServeGopher(w ResponseWriter, r *Request) {
+	m.WriteTo(w)
+}
+
+// ServeHTTP writes the metrics for scraping by Prometheus.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,55 @@
+package gopher_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	metrics := gopher.NewMetricsWithBuckets([]float64{60})
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/hello", hello)
+	mux.Handle("/metrics", metrics)
+
+	addr, stop := startServer(t, &gopher.Server{Handler: mux, Metrics: metrics})
+	defer stop()
+
+	for _, selector := range []string{"1hello", "1hello", "1missing"} {
+		_, err := gopher.Get(fmt.Sprintf("gopher://%s/%s", addr, selector))
+		require.NoError(err)
+	}
+
+	res, err := gopher.Get(fmt.Sprintf("gopher://%s/0metrics", addr))
+	require.NoError(err)
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(err)
+
+	text := string(body)
+	assert.Contains(text, "# TYPE gopher_requests_total counter\n")
+	assert.Contains(text, `gopher_requests_total{pattern="/hello",kind="menu"} 2`+"\n")
+	assert.Contains(text, `gopher_requests_total{pattern="",kind="menu"} 1`+"\n")
+	assert.Contains(text, `gopher_error_items_total{pattern="/hello"} 0`+"\n")
+	assert.Contains(text, `gopher_error_items_total{pattern=""} 1`+"\n")
+	assert.Contains(text, `gopher_response_bytes_total{pattern="/hello"} 64`+"\n")
+	assert.Contains(text, `gopher_request_duration_seconds_bucket{pattern="/hello",le="60"} 2`+"\n")
+	assert.Contains(text, `gopher_request_duration_seconds_bucket{pattern="/hello",le="+Inf"} 2`+"\n")
+	assert.Contains(text, `gopher_request_duration_seconds_count{pattern="/hello"} 2`+"\n")
+	assert.Contains(text, "gopher_active_connections 1\n")
+	assert.Contains(text, "gopher_accept_errors_total 0\n")
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal("text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(rec.Body.String(), `gopher_requests_total{pattern="/hello",kind="menu"} 2`+"\n")
+}
@@ -0,0 +1,33 @@
+package gopher
+
+// A Middleware wraps a Handler to add behaviour that runs before
+// and/or after it, such as logging, authentication or rate limiting.
+//
+//	func logger(next gopher.Handler) gopher.Handler {
+//		return gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+//			log.Printf("%s %s", r.RemoteAddr, r.Selector)
+//			next.ServeGopher(w, r)
+//		})
+//	}
+//
+// Middleware is registered for every request of a ServeMux with Use,
+// or for a single pattern by passing it to Handle or HandleFunc.
+type Middleware func(Handler) Handler
+
+func (m Middleware) applyRoute(e *muxEntry) {
+	e.mw = append(e.mw, m)
+}
+
+// Chain returns h wrapped by the given middleware. The first middleware
+// is the outermost one, so it runs first when a request is served:
+//
+//	Chain(h, a, b, c) == a(b(c(h)))
+//
+// Chain may be used to wrap the Handler of a Server with middleware
+// that should run for every request, whatever its Handler does.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
@@ -0,0 +1,121 @@
+package gopher_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// tag returns middleware that writes name as an info item before
+// calling the next handler.
+func tag(name string) gopher.Middleware {
+	return func(next gopher.Handler) gopher.Handler {
+		return gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+			w.WriteInfo(name + " " + r.Pattern)
+			next.ServeGopher(w, r)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := gopher.NewServeMux()
+	mux.Use(tag("global1"), tag("global2"))
+	mux.HandleFunc("/hello", hello, tag("route1"), tag("route2"))
+	mux.HandleFunc("/plain", hello)
+
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+
+	descriptions := func(selector string) []string {
+		res, err := gopher.Get(fmt.Sprintf("gopher://%s/1%s", addr, selector))
+		require.NoError(err)
+		var out []string
+		for _, item := range res.Dir.Items {
+			out = append(out, item.Description)
+		}
+		return out
+	}
+
+	assert.Equal([]string{
+		"global1 /hello",
+		"global2 /hello",
+		"route1 /hello",
+		"route2 /hello",
+		"Hello World!",
+	}, descriptions("hello"))
+
+	assert.Equal([]string{
+		"global1 /plain",
+		"global2 /plain",
+		"Hello World!",
+	}, descriptions("plain"))
+
+	assert.Equal([]string{
+		"global1 ",
+		"global2 ",
+		"resource not found",
+	}, descriptions("missing"))
+}
+
+func TestChain(t *testing.T) {
+	assert := assert.New(t)
+
+	var order []string
+	mw := func(name string) gopher.Middleware {
+		return func(next gopher.Handler) gopher.Handler {
+			return gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+				order = append(order, name)
+				next.ServeGopher(w, r)
+			})
+		}
+	}
+
+	h := gopher.Chain(gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		order = append(order, "handler")
+	}), mw("a"), mw("b"), mw("c"))
+	h.ServeGopher(nil, &gopher.Request{})
+
+	assert.Equal([]string{"a", "b", "c", "handler"}, order)
+}
+
+func TestMiddlewareWrapsOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	var wrapped, seen int
+	mux := gopher.NewServeMux()
+	mux.Use(func(next gopher.Handler) gopher.Handler {
+		wrapped++
+		return gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+			seen++
+			next.ServeGopher(w, r)
+		})
+	})
+	mux.HandleFunc("/hello", hello)
+	mux.HandleFunc("/images/", hello)
+
+	for i := 0; i < 3; i++ {
+		mux.ServeGopher(&recorder{}, &gopher.Request{Selector: "/hello"})
+	}
+	assert.Equal(1, wrapped)
+	assert.Equal(3, seen)
+
+	// redirects and rejected selectors go through the middleware too
+	for _, policy := range []gopher.RedirectPolicy{gopher.RedirectMenu, gopher.RejectNonCanonical} {
+		mux.RedirectPolicy = policy
+		for _, selector := range []string{"/images", "/a/../images/x"} {
+			seen = 0
+			rec := &recorder{}
+			mux.ServeGopher(rec, &gopher.Request{Selector: selector})
+			assert.Equal(1, seen, selector)
+			assert.Len(rec.items, 1, selector)
+		}
+	}
+	assert.Equal(1, wrapped)
+}
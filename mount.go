@@ -0,0 +1,145 @@
+package gopher
+
+import (
+	"strings"
+)
+
+// StripPrefix returns a handler that serves Gopher requests by removing
+// the given prefix from the request's Selector and invoking the handler
+// h. StripPrefix handles a request for a selector that doesn't begin
+// with prefix by replying with a resource not found error.
+//
+// The stripped prefix is appended to the request's MountPoint, and
+// added back to the selectors of the items h writes without a host or
+// port, so links generated by h keep working from outside the mount.
+// Items naming a host and port, even those of this server, are left
+// alone, which lets h link outside the mount:
+//
+//	gopher.Handle("/files/", gopher.StripPrefix("/files", gopher.FileServer(gopher.Dir("/srv"))))
+func StripPrefix(prefix string, h Handler) Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return h
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if !strings.HasPrefix(r.Selector, prefix) {
+			NotFound(w, r)
+			return
+		}
+		selector := strings.TrimPrefix(r.Selector, prefix)
+		if selector != "" && selector[0] != '/' {
+			// "/filesystem" does not lie below "/files"
+			NotFound(w, r)
+			return
+		}
+		if selector == "" {
+			selector = "/"
+		}
+
+		r2 := new(Request)
+		*r2 = *r
+		r2.Selector = selector
+		r2.MountPoint = r.MountPoint + prefix
+		h.ServeGopher(newPrefixWriter(w, prefix, r2), r2)
+	})
+}
+
+// Mount registers h to serve every selector below prefix, with prefix
+// stripped from the selector as done by StripPrefix. Mounting h at
+// "/files" serves "/files/notes.txt" as the selector "/notes.txt",
+// and "/files/" as "/".
+func (mux *ServeMux) Mount(prefix string, h Handler, opts ...RouteOption) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/", StripPrefix(prefix, h), opts...)
+}
+
+// Mount registers h to serve every selector below prefix in the
+// DefaultServeMux, as documented for ServeMux.Mount.
+func Mount(prefix string, h Handler, opts ...RouteOption) {
+	DefaultServeMux.Mount(prefix, h, opts...)
+}
+
+// prefixWriter adds the mount prefix back to the selectors of local
+// items written by a handler mounted with StripPrefix.
+type prefixWriter struct {
+	ResponseWriter
+	prefix string
+	req    *Request
+}
+
+// newPrefixWriter wraps w in a prefixWriter implementing the same
+// optional interfaces as w, so that handlers can still tell which of
+// them the response supports.
+func newPrefixWriter(w ResponseWriter, prefix string, r *Request) ResponseWriter {
+	pw := &prefixWriter{ResponseWriter: w, prefix: prefix, req: r}
+	f, isFlusher := w.(Flusher)
+	h, isHijacker := w.(Hijacker)
+	i, isInfo := w.(ResponseInfo)
+
+	switch {
+	case isFlusher && isHijacker && isInfo:
+		return struct {
+			*prefixWriter
+			Flusher
+			Hijacker
+			ResponseInfo
+		}{pw, f, h, i}
+	case isFlusher && isHijacker:
+		return struct {
+			*prefixWriter
+			Flusher
+			Hijacker
+		}{pw, f, h}
+	case isFlusher && isInfo:
+		return struct {
+			*prefixWriter
+			Flusher
+			ResponseInfo
+		}{pw, f, i}
+	case isHijacker && isInfo:
+		return struct {
+			*prefixWriter
+			Hijacker
+			ResponseInfo
+		}{pw, h, i}
+	case isFlusher:
+		return struct {
+			*prefixWriter
+			Flusher
+		}{pw, f}
+	case isHijacker:
+		return struct {
+			*prefixWriter
+			Hijacker
+		}{pw, h}
+	case isInfo:
+		return struct {
+			*prefixWriter
+			ResponseInfo
+		}{pw, i}
+	}
+	return pw
+}
+
+// isLocal reports whether i links to a selector relative to the root
+// of the handler: it has neither host nor port. Items naming a host,
+// even that of this server, link to where they say.
+func isLocal(i *Item) bool {
+	switch i.Type {
+	case INFO, ERROR:
+		return false
+	}
+	if !strings.HasPrefix(i.Selector, "/") {
+		return false
+	}
+	return i.Host == "" && i.Port == 0
+}
+
+func (w *prefixWriter) WriteItem(i *Item) error {
+	if isLocal(i) {
+		item := *i
+		item.Selector = w.prefix + i.Selector
+		i = &item
+	}
+	return w.ResponseWriter.WriteItem(i)
+}
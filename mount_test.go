@@ -0,0 +1,136 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestMount(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := gopher.NewServeMux()
+	mux.Mount("/files/", gopher.FileServer(gopher.Dir("./testdata/files")))
+	mux.HandleFunc("/where", func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo(r.MountPoint + " " + r.Selector)
+	})
+	mux.Mount("/nested", gopher.StripPrefix("/inner", mux))
+
+	serve := func(selector string) *recorder {
+		rec := &recorder{}
+		mux.ServeGopher(rec, &gopher.Request{
+			Selector:  selector,
+			LocalHost: "localhost",
+			LocalPort: 70,
+		})
+		return rec
+	}
+
+	rec := serve("/files/")
+	require.Len(rec.items, 2)
+	assert.Equal("notes.txt", rec.items[0].Description)
+	assert.Equal("/files/notes.txt", rec.items[0].Selector)
+	assert.Equal(gopher.FILE, rec.items[0].Type)
+	assert.Equal("sub", rec.items[1].Description)
+	assert.Equal("/files/sub", rec.items[1].Selector)
+	assert.Equal(gopher.DIRECTORY, rec.items[1].Type)
+
+	rec = serve("/files/sub")
+	require.Len(rec.items, 1)
+	assert.Equal("/files/sub/readme.txt", rec.items[0].Selector)
+
+	rec = serve("/files/notes.txt")
+	assert.Len(rec.items, 0)
+	assert.Equal("Some notes.\n", rec.body.String())
+
+	rec = serve("/nested/inner/where")
+	require.Len(rec.items, 1)
+	assert.Equal("/nested/inner /where", rec.items[0].Description)
+
+	rec = serve("/nested/innerwhere")
+	require.Len(rec.items, 1)
+	assert.Equal(gopher.ERROR, rec.items[0].Type)
+}
+
+func TestStripPrefixItems(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := gopher.StripPrefix("/blog", gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo("info")
+		w.WriteItem(&gopher.Item{Type: gopher.FILE, Selector: "/post"})
+		w.WriteItem(&gopher.Item{Type: gopher.FILE, Selector: "/local", Host: "localhost", Port: 70})
+		w.WriteItem(&gopher.Item{Type: gopher.DIRECTORY, Selector: "/", Host: "gopher.floodgap.com", Port: 70})
+		w.WriteItem(&gopher.Item{Type: gopher.HTML, Selector: "URL:https://example.com"})
+	}))
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/blog/", LocalHost: "localhost", LocalPort: 70})
+
+	require.Len(rec.items, 5)
+	assert.Equal("", rec.items[0].Selector)
+	assert.Equal("/blog/post", rec.items[1].Selector)
+	assert.Equal("/local", rec.items[2].Selector) // explicitly outside the mount
+	assert.Equal("/", rec.items[3].Selector)
+	assert.Equal("URL:https://example.com", rec.items[4].Selector)
+}
+
+// flushRecorder is a recorder that can flush, but not hijack.
+type flushRecorder struct {
+	recorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() error {
+	r.flushes++
+	return nil
+}
+
+func TestStripPrefixInterfaces(t *testing.T) {
+	supports := func(w gopher.ResponseWriter) []string {
+		var got []string
+		if _, ok := w.(gopher.Flusher); ok {
+			got = append(got, "Flusher")
+		}
+		if _, ok := w.(gopher.Hijacker); ok {
+			got = append(got, "Hijacker")
+		}
+		if _, ok := w.(gopher.ResponseInfo); ok {
+			got = append(got, "ResponseInfo")
+		}
+		return got
+	}
+
+	var got []string
+	h := gopher.StripPrefix("/files", gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		got = supports(w)
+		if f, ok := w.(gopher.Flusher); ok {
+			f.Flush()
+		}
+		w.WriteItem(&gopher.Item{Type: gopher.FILE, Selector: "/notes.txt"})
+	}))
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/files/"})
+	assert.Empty(t, got)
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, "/files/notes.txt", rec.items[0].Selector)
+
+	frec := &flushRecorder{}
+	h.ServeGopher(frec, &gopher.Request{Selector: "/files/"})
+	assert.Equal(t, []string{"Flusher"}, got)
+	assert.Equal(t, 1, frec.flushes)
+	require.Len(t, frec.items, 1)
+	assert.Equal(t, "/files/notes.txt", frec.items[0].Selector)
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/files/", h)
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+	rawRequest(t, addr, "/files/\r\n")
+	assert.Equal(t, []string{"Flusher", "Hijacker", "ResponseInfo"}, got)
+}
@@ -0,0 +1,103 @@
+package gopher
+
+import (
+	"path"
+	"strings"
+)
+
+// A RedirectPolicy decides how a ServeMux answers requests for selectors
+// that are not canonical: selectors containing "." or ".." elements or
+// repeated slashes, and subtree roots requested without their trailing
+// slash.
+type RedirectPolicy int
+
+const (
+	// RedirectMenu replies with a redirect menu pointing at the
+	// canonical selector, as written by Redirect.
+	RedirectMenu RedirectPolicy = iota
+
+	// ServeCanonical serves the canonical selector transparently,
+	// as if the client had requested it.
+	ServeCanonical
+
+	// RejectNonCanonical replies with an error item.
+	RejectNonCanonical
+)
+
+// Redirect replies to the request with a menu holding the single item
+// i, which should point at the new location of the requested resource.
+// Gopher has no redirect status, so this is the closest equivalent:
+// clients show the item and the user follows it.
+//
+// If i.Description is empty it is set to a message naming the new
+// selector, as seen from outside any mount point. Like other items, i
+// points at the local server if both Host and Port are empty.
+func Redirect(w ResponseWriter, r *Request, i *Item) {
+	item := *i
+	if item.Description == "" {
+		selector := item.Selector
+		if isLocal(&item) {
+			selector = r.MountPoint + selector
+		}
+		item.Description = "Moved to " + selector
+	}
+	w.WriteItem(&item)
+}
+
+// cleanPath returns the canonical path for p, eliminating . and ..
+// elements and repeated slashes but keeping any trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	// path.Clean removes trailing slash except for root;
+	// put the trailing slash back if necessary.
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// canonical returns the canonical form of selector and the entry that
+// serves it. Selectors naming the root of a registered subtree without
+// its trailing slash are completed with the slash, unless registered
+// separately. mux.mu must be held.
+func (mux *ServeMux) canonical(selector string) (string, *muxEntry) {
+	if strings.HasPrefix(strings.TrimPrefix(selector, "/"), "URL:") {
+		return selector, nil
+	}
+
+	canonical := cleanPath(selector)
+	e, _ := mux.lookup(canonical)
+
+	if !strings.HasSuffix(canonical, "/") && (e.wildcard || e.pattern == "") {
+		if e2, _ := mux.lookup(canonical + "/"); e2.wildcard && e2 != e {
+			return canonical + "/", e2
+		}
+	}
+	return canonical, e
+}
+
+// redirectType returns the item type used to redirect r to the
+// canonical selector served by e: the type declared with WithItemType,
+// else that of the request, a search if it has a query and a menu if
+// the selector ends with a slash, else the type detected from the
+// name of the selector, else DIRECTORY.
+func (e *muxEntry) redirectType(r *Request, canonical string) ItemType {
+	switch {
+	case e != nil && e.itemType != 0:
+		return e.itemType
+	case r.Query != "":
+		return INDEXSEARCH
+	case strings.HasSuffix(canonical, "/"):
+		return DIRECTORY
+	}
+	if t, ok := DefaultTypeDetector.DetectType(&FileSample{Name: canonical}); ok {
+		return t
+	}
+	return DIRECTORY
+}
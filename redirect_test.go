@@ -0,0 +1,81 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestServeMuxRedirects(t *testing.T) {
+	echo := func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo(r.Pattern + " " + r.Selector)
+	}
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/", echo)
+	mux.HandleFunc("/images/", echo)
+	mux.HandleFunc("/docs/", echo)
+	mux.HandleFunc("/docs", echo)
+	mux.HandleFunc("/about", echo)
+
+	tests := []struct {
+		selector string
+		policy   gopher.RedirectPolicy
+		want     gopher.Item
+	}{
+		{"/about", gopher.RedirectMenu, gopher.Item{Type: gopher.INFO, Description: "/about /about"}},
+		{"/images", gopher.RedirectMenu, gopher.Item{Type: gopher.DIRECTORY, Description: "Moved to /images/", Selector: "/images/"}},
+		{"/docs", gopher.RedirectMenu, gopher.Item{Type: gopher.INFO, Description: "/docs /docs"}},
+		{"//about", gopher.RedirectMenu, gopher.Item{Type: gopher.DIRECTORY, Description: "Moved to /about", Selector: "/about"}},
+		{"/images/../about", gopher.RedirectMenu, gopher.Item{Type: gopher.DIRECTORY, Description: "Moved to /about", Selector: "/about"}},
+		{"/images/./a//b/", gopher.RedirectMenu, gopher.Item{Type: gopher.DIRECTORY, Description: "Moved to /images/a/b/", Selector: "/images/a/b/"}},
+		{"/URL:http://example.com", gopher.RedirectMenu, gopher.Item{Type: gopher.INFO, Description: "/ /URL:http://example.com"}},
+		{"/images/../about", gopher.ServeCanonical, gopher.Item{Type: gopher.INFO, Description: "/about /about"}},
+		{"/images", gopher.ServeCanonical, gopher.Item{Type: gopher.INFO, Description: "/images/ /images/"}},
+		{"/images/../about", gopher.RejectNonCanonical, gopher.Item{Type: gopher.ERROR, Description: "invalid selector"}},
+		{"/images/./notes.txt", gopher.RedirectMenu, gopher.Item{Type: gopher.FILE, Description: "Moved to /images/notes.txt", Selector: "/images/notes.txt"}},
+		{"//images/cat.GIF", gopher.RedirectMenu, gopher.Item{Type: gopher.GIF, Description: "Moved to /images/cat.GIF", Selector: "/images/cat.GIF"}},
+	}
+
+	for _, tt := range tests {
+		mux.RedirectPolicy = tt.policy
+
+		rec := &recorder{}
+		mux.ServeGopher(rec, &gopher.Request{Selector: tt.selector})
+		if assert.Len(t, rec.items, 1, tt.selector) {
+			assert.Equal(t, tt.want.Type, rec.items[0].Type, tt.selector)
+			assert.Equal(t, tt.want.Description, rec.items[0].Description, tt.selector)
+			assert.Equal(t, tt.want.Selector, rec.items[0].Selector, tt.selector)
+		}
+	}
+
+	// searches are redirected to searches
+	mux.RedirectPolicy = gopher.RedirectMenu
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "//about", Query: "gophers"})
+	require.Len(t, rec.items, 1)
+	assert.Equal(t, gopher.INDEXSEARCH, rec.items[0].Type)
+}
+
+func TestRedirectMounted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	inner := gopher.NewServeMux()
+	inner.HandleFunc("/old", func(w gopher.ResponseWriter, r *gopher.Request) {
+		gopher.Redirect(w, r, &gopher.Item{Type: gopher.FILE, Selector: "/new"})
+	})
+
+	mux := gopher.NewServeMux()
+	mux.Mount("/blog", inner)
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/blog/old"})
+	require.Len(rec.items, 1)
+	assert.Equal(gopher.FILE, rec.items[0].Type)
+	assert.Equal("Moved to /blog/new", rec.items[0].Description)
+	assert.Equal("/blog/new", rec.items[0].Selector)
+}
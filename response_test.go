@@ -0,0 +1,167 @@
+package gopher_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestFlusher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	flushed := make(chan struct{})
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/stream", func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.Write([]byte("first\n"))
+		require.NoError(w.(gopher.Flusher).Flush())
+		<-flushed
+		w.Write([]byte("second\n"))
+	})
+
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(err)
+	defer conn.Close()
+	fmt.Fprint(conn, "/stream\r\n")
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(err)
+	assert.Equal("first\n", line)
+	close(flushed)
+
+	rest, err := ioutil.ReadAll(reader)
+	require.NoError(err)
+	assert.Equal("second\n", string(rest))
+}
+
+func TestHijacker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	states := make(chan gopher.ConnState, 8)
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/hijack", func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo("before")
+
+		conn, rw, err := w.(gopher.Hijacker).Hijack()
+		require.NoError(err)
+		defer conn.Close()
+
+		rw.WriteString("after\r\n")
+		rw.Flush()
+
+		assert.Equal(gopher.ErrHijacked, w.WriteInfo("ignored"))
+	})
+
+	addr, stop := startServer(t, &gopher.Server{
+		Handler: mux,
+		ConnState: func(c net.Conn, state gopher.ConnState) {
+			states <- state
+		},
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(err)
+	defer conn.Close()
+	fmt.Fprint(conn, "/hijack\r\n")
+
+	out, err := ioutil.ReadAll(conn)
+	require.NoError(err)
+	assert.Equal("ibefore\t\terror.host\t1\r\nafter\r\n", string(out))
+
+	assert.Equal(gopher.StateNew, <-states)
+	assert.Equal(gopher.StateActive, <-states)
+	assert.Equal(gopher.StateHijacked, <-states)
+	assert.Len(states, 0)
+}
+
+func TestHijackerBufferedInput(t *testing.T) {
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/echo", func(w gopher.ResponseWriter, r *gopher.Request) {
+		conn, rw, err := w.(gopher.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		line, err := rw.ReadString('\n')
+		require.NoError(t, err)
+		rw.WriteString("echo: " + line)
+		rw.Flush()
+	})
+
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the line after the request arrives along with it, and is
+	// buffered by the server before the handler hijacks the connection
+	fmt.Fprint(conn, "/echo\r\nhello\n")
+
+	out, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", string(out))
+}
+
+func TestResponseInfo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	infos := make(chan gopher.ResponseInfo, 1)
+
+	inspect := func(next gopher.Handler) gopher.Handler {
+		return gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+			info := w.(gopher.ResponseInfo)
+			assert.Equal(gopher.NoResponse, info.Kind())
+			next.ServeGopher(w, r)
+			infos <- info
+		})
+	}
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/info", inspect(gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo("Hello World!")
+		w.WriteError("oops")
+	})))
+	mux.Handle("/doc", inspect(gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.Write([]byte("Hello World!"))
+	})))
+
+	addr, stop := startServer(t, &gopher.Server{Handler: mux})
+	defer stop()
+
+	_, err := gopher.Get(fmt.Sprintf("gopher://%s/1info", addr))
+	require.NoError(err)
+
+	info := <-infos
+	assert.Equal(gopher.MenuResponse, info.Kind())
+	assert.Equal(2, info.ItemsWritten())
+	assert.True(info.WroteError())
+
+	res, err := gopher.Get(fmt.Sprintf("gopher://%s/0doc", addr))
+	require.NoError(err)
+	res.Body.Close()
+
+	info = <-infos
+	assert.Equal(gopher.DocumentResponse, info.Kind())
+	assert.Equal(int64(len("Hello World!")), info.BytesWritten())
+	assert.Equal(0, info.ItemsWritten())
+	assert.False(info.WroteError())
+}
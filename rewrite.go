@@ -0,0 +1,188 @@
+package gopher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RewriteFlags control what happens after a RewriteRule has matched.
+type RewriteFlags int
+
+const (
+	// RewriteStop stops processing further rules once this rule has
+	// matched ("L" in rule files). By default processing continues
+	// with the next rule and the rewritten selector.
+	RewriteStop RewriteFlags = 1 << iota
+
+	// RewriteRedirect replies with a redirect menu pointing at the
+	// rewritten selector instead of serving it ("R" in rule files).
+	// It implies RewriteStop.
+	RewriteRedirect
+)
+
+// A RewriteRule rewrites selectors matching Pattern.
+type RewriteRule struct {
+	// Pattern is matched against the selector.
+	Pattern *regexp.Regexp
+
+	// Replacement is the new selector. It may refer to submatches of
+	// Pattern as $1 or ${name}, as in regexp.Regexp.Expand. If empty,
+	// the selector is left unchanged.
+	Replacement string
+
+	Flags RewriteFlags
+
+	// Type is the type of the redirect item when RewriteRedirect is
+	// set. If zero, DIRECTORY is used.
+	Type ItemType
+}
+
+// RewriteHandler returns a handler that rewrites the selector of each
+// request with rules before invoking h. Rules are tried in order; the
+// first rule whose pattern matches the selector replaces it, and unless
+// the rule has RewriteStop or RewriteRedirect set, the following rules
+// are tried against the new selector.
+//
+// The rewritten request keeps the selector sent by the client in
+// RawSelector. Rules are typically loaded with LoadRewriteRules, for
+// instance to keep the selectors of a gopherhole moved from another
+// server working:
+//
+//	rules, err := gopher.LoadRewriteRules("rewrite.conf")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	gopher.ListenAndServe(":70", gopher.RewriteHandler(mux, rules...))
+func RewriteHandler(h Handler, rules ...RewriteRule) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		selector := r.Selector
+
+		for _, rule := range rules {
+			match := rule.Pattern.FindStringSubmatchIndex(selector)
+			if match == nil {
+				continue
+			}
+			if rule.Replacement != "" {
+				selector = string(rule.Pattern.ExpandString(nil, rule.Replacement, selector, match))
+			}
+
+			if rule.Flags&RewriteRedirect != 0 {
+				t := rule.Type
+				if t == 0 {
+					t = DIRECTORY
+				}
+				Redirect(w, r, &Item{Type: t, Selector: selector})
+				return
+			}
+			if rule.Flags&RewriteStop != 0 {
+				break
+			}
+		}
+
+		if selector == r.Selector {
+			h.ServeGopher(w, r)
+			return
+		}
+
+		r2 := new(Request)
+		*r2 = *r
+		r2.Selector = selector
+		if r2.RawSelector == "" {
+			r2.RawSelector = r.Selector
+		}
+		h.ServeGopher(w, r2)
+	})
+}
+
+// ParseRewriteRules parses rewrite rules, one per line, in the format:
+//
+//	pattern replacement [flags]
+//
+// Fields are separated by whitespace, so patterns should match spaces
+// with \s. A replacement of "-" leaves the selector unchanged. Flags are
+// a comma separated list in square brackets: "L" sets RewriteStop, "R"
+// sets RewriteRedirect and "R=t" also sets the redirect item type to t.
+// Blank lines and lines starting with "#" are ignored. For example:
+//
+//	# Gophernicus style selectors
+//	^/[0-9a-zA-Z]/(~.*)$  /$1       [L]
+//	^/phlog$              /phlog/   [R]
+//	^/old/(.*)\.txt$      /new/$1   [R=0]
+func ParseRewriteRules(r io.Reader) ([]RewriteRule, error) {
+	var rules []RewriteRule
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		rule, err := parseRewriteRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("gopher: rewrite rule on line %d: %v", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func parseRewriteRule(line string) (rule RewriteRule, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return rule, fmt.Errorf("expected pattern, replacement and optional flags, got %q", line)
+	}
+
+	rule.Pattern, err = regexp.Compile(fields[0])
+	if err != nil {
+		return rule, err
+	}
+
+	if fields[1] != "-" {
+		rule.Replacement = fields[1]
+	}
+
+	if len(fields) < 3 {
+		return rule, nil
+	}
+
+	flags := fields[2]
+	if !strings.HasPrefix(flags, "[") || !strings.HasSuffix(flags, "]") {
+		return rule, fmt.Errorf("flags must be enclosed in brackets, got %q", flags)
+	}
+	for _, flag := range strings.Split(flags[1:len(flags)-1], ",") {
+		switch {
+		case flag == "L":
+			rule.Flags |= RewriteStop
+		case flag == "R":
+			rule.Flags |= RewriteRedirect
+		case strings.HasPrefix(flag, "R=") && len(flag) == 3:
+			rule.Flags |= RewriteRedirect
+			rule.Type = ItemType(flag[2])
+		default:
+			return rule, fmt.Errorf("unknown flag %q", flag)
+		}
+	}
+
+	return rule, nil
+}
+
+// LoadRewriteRules reads rewrite rules from the named file, as described
+// for ParseRewriteRules.
+func LoadRewriteRules(filename string) ([]RewriteRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseRewriteRules(f)
+}
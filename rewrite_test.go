@@ -0,0 +1,58 @@
+package gopher_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestRewriteHandler(t *testing.T) {
+	rules, err := gopher.LoadRewriteRules("./testdata/rewrite.conf")
+	require.NoError(t, err)
+	require.Len(t, rules, 5)
+
+	h := gopher.RewriteHandler(gopher.HandlerFunc(func(w gopher.ResponseWriter, r *gopher.Request) {
+		w.WriteInfo(r.RawSelector + " -> " + r.Selector)
+	}), rules...)
+
+	tests := []struct {
+		selector string
+		want     gopher.Item
+	}{
+		{"/0/~user/file.txt", gopher.Item{Type: gopher.INFO, Description: "/0/~user/file.txt -> /~user/file.txt"}},
+		{"/about", gopher.Item{Type: gopher.INFO, Description: "/about -> /pages/about"}},
+		{"/about/me", gopher.Item{Type: gopher.INFO, Description: "/about/me -> /about/me"}},
+		{"/1/phlog", gopher.Item{Type: gopher.DIRECTORY, Description: "Moved to /phlog/", Selector: "/phlog/"}},
+		{"/old/notes.txt", gopher.Item{Type: gopher.FILE, Description: "Moved to /new/notes", Selector: "/new/notes"}},
+	}
+
+	for _, tt := range tests {
+		rec := &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: tt.selector, RawSelector: tt.selector})
+		if assert.Len(t, rec.items, 1, tt.selector) {
+			assert.Equal(t, tt.want.Type, rec.items[0].Type, tt.selector)
+			assert.Equal(t, tt.want.Description, rec.items[0].Description, tt.selector)
+			assert.Equal(t, tt.want.Selector, rec.items[0].Selector, tt.selector)
+		}
+	}
+}
+
+func TestParseRewriteRulesErrors(t *testing.T) {
+	for _, rules := range []string{
+		"^/a$",
+		"^/a$ /b [L] extra",
+		"^/(a$ /b",
+		"^/a$ /b L",
+		"^/a$ /b [X]",
+		"^/a$ /b [R=10]",
+	} {
+		_, err := gopher.ParseRewriteRules(strings.NewReader("# ok\n\n" + rules))
+		if assert.Error(t, err, rules) {
+			assert.Contains(t, err.Error(), "line 3", rules)
+		}
+	}
+}
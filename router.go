@@ -0,0 +1,278 @@
+package gopher
+
+import (
+	"regexp"
+	"strings"
+)
+
+// paramTypes maps the named types usable in "{name:type}" placeholders
+// to the segments they accept. Any other type is used as a regular
+// expression that must match the whole segment.
+var paramTypes = map[string]func(string) bool{
+	"int":   isSegment("0123456789"),
+	"hex":   isSegment("0123456789abcdefABCDEF"),
+	"alpha": isSegment("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+	"alnum": isSegment("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+}
+
+func isSegment(chars string) func(string) bool {
+	return func(s string) bool {
+		for _, c := range s {
+			if !strings.ContainsRune(chars, c) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// A routeNode is a node in the tree of selector segments used by
+// ServeMux to find the handler for a selector. Each node corresponds
+// to one '/'-separated segment of the registered patterns, so lookups
+// take time proportional to the length of the selector rather than to
+// the number of patterns.
+type routeNode struct {
+	// static children, keyed by segment
+	static map[string]*routeNode
+
+	// placeholder children, in order of precedence: typed placeholders
+	// first, in registration order, then the untyped placeholder
+	params []*routeNode
+
+	// for placeholder nodes, the type given in the pattern ("" for
+	// any segment) and the function matching it
+	typ   string
+	match func(string) bool
+
+	// exact is the entry for a pattern ending at this node, and
+	// wildcard the entry for a pattern matching anything below it,
+	// either a rooted subtree ("/images/") or a named wildcard
+	// ("/images/*rest")
+	exact    *muxEntry
+	wildcard *muxEntry
+}
+
+// A routeSegment is a parsed segment of a pattern.
+type routeSegment struct {
+	static string
+	param  bool
+	name   string
+	typ    string
+}
+
+// parsePattern splits a pattern into its segments, reporting whether it
+// ends in a wildcard and the name the wildcard captures. Patterns
+// ending in a slash are unnamed wildcards.
+func parsePattern(pattern string) (segs []routeSegment, wildcard bool, wildName string) {
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+
+	last := parts[len(parts)-1]
+	if last == "" {
+		wildcard, parts = true, parts[:len(parts)-1]
+	} else if strings.HasPrefix(last, "*") {
+		wildcard, wildName, parts = true, last[1:], parts[:len(parts)-1]
+	}
+
+	for _, s := range parts {
+		switch {
+		case strings.HasPrefix(s, "*"):
+			panic("gopher: wildcard must be the last segment of pattern " + pattern)
+		case strings.HasPrefix(s, "{"):
+			if !strings.HasSuffix(s, "}") {
+				panic("gopher: invalid placeholder in pattern " + pattern)
+			}
+			name, typ := s[1:len(s)-1], ""
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name, typ = name[:i], name[i+1:]
+			}
+			if name == "" {
+				panic("gopher: unnamed placeholder in pattern " + pattern)
+			}
+			segs = append(segs, routeSegment{param: true, name: name, typ: typ})
+		default:
+			segs = append(segs, routeSegment{static: s})
+		}
+	}
+	return
+}
+
+// paramNames returns the names of the values captured by a pattern, in
+// the order they are captured.
+func paramNames(segs []routeSegment, wildcard bool, wildName string) []string {
+	var names []string
+	for _, s := range segs {
+		if s.param {
+			names = append(names, s.name)
+		}
+	}
+	if wildcard && wildName != "" {
+		names = append(names, wildName)
+	}
+	return names
+}
+
+// node returns the node for segs, creating it if needed.
+func (n *routeNode) node(pattern string, segs []routeSegment) *routeNode {
+	for _, s := range segs {
+		if !s.param {
+			child, ok := n.static[s.static]
+			if !ok {
+				if n.static == nil {
+					n.static = make(map[string]*routeNode)
+				}
+				child = &routeNode{}
+				n.static[s.static] = child
+			}
+			n = child
+			continue
+		}
+
+		var child *routeNode
+		for _, c := range n.params {
+			if c.typ == s.typ {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &routeNode{typ: s.typ, match: paramMatcher(pattern, s.typ)}
+			// typed placeholders take precedence over untyped ones
+			i := len(n.params)
+			if s.typ != "" {
+				for i = 0; i < len(n.params) && n.params[i].typ != ""; i++ {
+				}
+			}
+			n.params = append(n.params, nil)
+			copy(n.params[i+1:], n.params[i:])
+			n.params[i] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// remove clears the entry registered for segs, pruning nodes left
+// without entries. It reports whether n itself is left empty.
+func (n *routeNode) remove(segs []routeSegment, wildcard bool) bool {
+	if len(segs) == 0 {
+		if wildcard {
+			n.wildcard = nil
+		} else {
+			n.exact = nil
+		}
+		return n.empty()
+	}
+
+	s := segs[0]
+	if !s.param {
+		if child, ok := n.static[s.static]; ok && child.remove(segs[1:], wildcard) {
+			delete(n.static, s.static)
+		}
+		return n.empty()
+	}
+
+	for i, child := range n.params {
+		if child.typ != s.typ {
+			continue
+		}
+		if child.remove(segs[1:], wildcard) {
+			n.params = append(n.params[:i], n.params[i+1:]...)
+		}
+		break
+	}
+	return n.empty()
+}
+
+func (n *routeNode) empty() bool {
+	return n.exact == nil && n.wildcard == nil &&
+		len(n.static) == 0 && len(n.params) == 0
+}
+
+func paramMatcher(pattern, typ string) func(string) bool {
+	if typ == "" {
+		return func(string) bool { return true }
+	}
+	if m, ok := paramTypes[typ]; ok {
+		return m
+	}
+	re, err := regexp.Compile("^(?:" + typ + ")$")
+	if err != nil {
+		panic("gopher: invalid placeholder type in pattern " + pattern + ": " + err.Error())
+	}
+	return re.MatchString
+}
+
+// lookup finds the entry matching selector[pos:], where pos is the
+// offset of the '/' preceding the next segment, or the end of the
+// selector. Captured values are appended to params.
+//
+// Static segments are tried first, then placeholders in order of
+// precedence, and finally the wildcard of the node, so the most
+// specific pattern wins whatever the order of registration.
+func (n *routeNode) lookup(selector string, pos int, params []string) (*muxEntry, []string) {
+	if pos == len(selector) {
+		return n.exact, params
+	}
+	if selector[pos] != '/' {
+		return nil, params
+	}
+
+	end := strings.IndexByte(selector[pos+1:], '/')
+	if end < 0 {
+		end = len(selector)
+	} else {
+		end += pos + 1
+	}
+	seg := selector[pos+1 : end]
+
+	if child, ok := n.static[seg]; ok {
+		if e, p := child.lookup(selector, end, params); e != nil {
+			return e, p
+		}
+	}
+
+	if seg != "" {
+		for _, child := range n.params {
+			if !child.match(seg) {
+				continue
+			}
+			if e, p := child.lookup(selector, end, append(params, seg)); e != nil {
+				return e, p
+			}
+		}
+	}
+
+	if n.wildcard != nil {
+		if n.wildcard.wildName != "" {
+			params = append(params, selector[pos+1:])
+		}
+		return n.wildcard, params
+	}
+
+	return nil, params
+}
+
+// Param returns the value captured by the placeholder or wildcard
+// called name in the ServeMux pattern that matched the request, or the
+// empty string if there is no such placeholder.
+//
+// For the pattern "/posts/{year:int}/{slug}" and the selector
+// "/posts/2019/hello-world", Param("year") returns "2019" and
+// Param("slug") returns "hello-world".
+func (r *Request) Param(name string) string {
+	return r.params[name]
+}
+
+// setParams records the values captured for the named placeholders.
+// Values captured by an enclosing ServeMux are kept unless shadowed.
+func (r *Request) setParams(names, values []string) {
+	if len(names) == 0 {
+		return
+	}
+	if r.params == nil {
+		r.params = make(map[string]string, len(names))
+	}
+	for i, name := range names {
+		r.params[name] = values[i]
+	}
+}
@@ -0,0 +1,122 @@
+package gopher_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// echoParams writes the matched pattern and the requested params.
+func echoParams(names ...string) gopher.HandlerFunc {
+	return func(w gopher.ResponseWriter, r *gopher.Request) {
+		out := []string{r.Pattern}
+		for _, name := range names {
+			out = append(out, name+"="+r.Param(name))
+		}
+		w.WriteInfo(strings.Join(out, " "))
+	}
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	patterns := map[string][]string{
+		"/":                           nil,
+		"/about":                      nil,
+		"/images/":                    nil,
+		"/images/thumbnails/":         nil,
+		"/posts/new":                  nil,
+		"/posts/{year:int}":           {"year"},
+		"/posts/{year:int}/{slug}":    {"year", "slug"},
+		"/posts/{slug}":               {"slug"},
+		"/posts/{slug}/edit":          {"slug"},
+		"/posts/{code:[a-z]{3}[0-9]}": {"code"},
+		"/tags/{tag}/*rest":           {"tag", "rest"},
+		"/files/*":                    nil,
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"/", "/"},
+		{"/about", "/about"},
+		{"/about/", "/"},
+		{"/unknown/path", "/"},
+		{"/images", "Moved to /images/"},
+		{"/images/", "/images/"},
+		{"/images/a.png", "/images/"},
+		{"/images/thumbnails/a.png", "/images/thumbnails/"},
+		{"/posts/new", "/posts/new"},
+		{"/posts/new/edit", "/posts/{slug}/edit slug=new"},
+		{"/posts/2019", "/posts/{year:int} year=2019"},
+		{"/posts/2019/hello-world", "/posts/{year:int}/{slug} year=2019 slug=hello-world"},
+		{"/posts/abc1", "/posts/{code:[a-z]{3}[0-9]} code=abc1"},
+		{"/posts/hello-world", "/posts/{slug} slug=hello-world"},
+		{"/posts/hello-world/edit", "/posts/{slug}/edit slug=hello-world"},
+		{"/posts/hello-world/other", "/"},
+		{"/posts/", "/"},
+		{"/tags/go/", "/tags/{tag}/*rest tag=go rest="},
+		{"/tags/go/2019/01", "/tags/{tag}/*rest tag=go rest=2019/01"},
+		{"/tags/go", "Moved to /tags/go/"},
+		{"/files/a/b", "/files/*"},
+	}
+
+	// Registration order must not matter
+	keys := make([]string, 0, len(patterns))
+	for k := range patterns {
+		keys = append(keys, k)
+	}
+	for i := 0; i < 5; i++ {
+		rand.Shuffle(len(keys), func(a, b int) { keys[a], keys[b] = keys[b], keys[a] })
+
+		mux := gopher.NewServeMux()
+		for _, k := range keys {
+			mux.Handle(k, echoParams(patterns[k]...))
+		}
+
+		for _, tt := range tests {
+			rec := &recorder{}
+			mux.ServeGopher(rec, &gopher.Request{Selector: tt.selector})
+			if assert.Len(t, rec.items, 1, tt.selector) {
+				assert.Equal(t, tt.want, rec.items[0].Description, tt.selector)
+			}
+		}
+	}
+}
+
+func TestServeMuxConflicts(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/posts/{id}", hello)
+	mux.HandleFunc("/images/", hello)
+
+	assert.Panics(func() { mux.HandleFunc("/posts/{id}", hello) })
+	assert.Panics(func() { mux.HandleFunc("/posts/{slug}", hello) })
+	assert.Panics(func() { mux.HandleFunc("/images/*rest", hello) })
+	assert.Panics(func() { mux.HandleFunc("/a/*rest/b", hello) })
+	assert.Panics(func() { mux.HandleFunc("/a/{id", hello) })
+	assert.Panics(func() { mux.HandleFunc("/a/{id:[}", hello) })
+	assert.NotPanics(func() { mux.HandleFunc("/posts/{id:int}", hello) })
+}
+
+func BenchmarkServeMux(b *testing.B) {
+	mux := gopher.NewServeMux()
+	for i := 0; i < 5000; i++ {
+		mux.HandleFunc(fmt.Sprintf("/section%d/page%d", i%50, i), hello)
+		mux.HandleFunc(fmt.Sprintf("/section%d/page%d/{comment:int}", i%50, i), hello)
+	}
+	mux.HandleFunc("/", hello)
+
+	r := &gopher.Request{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Selector = "/section42/page4242/17"
+		mux.Handler(r)
+	}
+}
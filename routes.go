@@ -0,0 +1,194 @@
+package gopher
+
+import (
+	"sort"
+	"strings"
+)
+
+// A RouteOption configures a pattern registered with ServeMux.Handle.
+// Middleware is a RouteOption, as are the options returned by Describe
+// and WithItemType.
+type RouteOption interface {
+	applyRoute(e *muxEntry)
+}
+
+type routeOptionFunc func(e *muxEntry)
+
+func (f routeOptionFunc) applyRoute(e *muxEntry) {
+	f(e)
+}
+
+// Describe returns a RouteOption that documents a route with a short,
+// human readable description. Described routes are listed by
+// IndexHandler.
+//
+//	mux.HandleFunc("/about", about, gopher.Describe("About this server"))
+func Describe(description string) RouteOption {
+	return routeOptionFunc(func(e *muxEntry) {
+		e.description = description
+	})
+}
+
+// WithItemType returns a RouteOption that declares the type of item
+// clients should use to fetch the route, such as FILE for a handler
+// writing a document. Routes without a declared type are assumed to be
+// menus.
+func WithItemType(t ItemType) RouteOption {
+	return routeOptionFunc(func(e *muxEntry) {
+		e.itemType = t
+	})
+}
+
+// A Route describes a pattern registered with a ServeMux.
+type Route struct {
+	Pattern     string   // pattern as registered
+	Description string   // description given with Describe, if any
+	Type        ItemType // type given with WithItemType, or zero
+}
+
+// Routes returns the patterns registered with mux, sorted by pattern.
+func (mux *ServeMux) Routes() []Route {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	routes := make([]Route, 0, len(mux.m))
+	for _, e := range mux.m {
+		routes = append(routes, Route{
+			Pattern:     e.pattern,
+			Description: e.description,
+			Type:        e.itemType,
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes
+}
+
+// IndexHandler returns a handler that replies with a menu linking to
+// every route of mux registered with a description. Routes are grouped
+// by the first segment of their pattern, each group under a heading,
+// with top-level routes listed first.
+//
+// Routes with placeholders cannot be linked to and are left out; a
+// route ending in a wildcard, such as "/files/*path", is linked as the
+// subtree root "/files/". Links use the type given with WithItemType,
+// or DIRECTORY.
+//
+// IndexHandler makes a convenient "/" page for small services:
+//
+//	mux.Handle("/", gopher.IndexHandler(mux))
+func IndexHandler(mux *ServeMux) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		var (
+			groups []string
+			items  = make(map[string][]*Item)
+		)
+
+		for _, route := range mux.Routes() {
+			if route.Description == "" || strings.Contains(route.Pattern, "{") {
+				continue
+			}
+
+			selector := route.Pattern
+			if i := strings.LastIndexByte(selector, '/'); strings.HasPrefix(selector[i+1:], "*") {
+				selector = selector[:i+1]
+			}
+
+			group := "/"
+			if i := strings.IndexByte(strings.TrimPrefix(selector, "/"), '/'); i >= 0 {
+				group = selector[:i+2]
+				if group == selector {
+					// the subtree root belongs with its parent
+					group = "/"
+				}
+			}
+			if _, ok := items[group]; !ok {
+				groups = append(groups, group)
+			}
+
+			t := route.Type
+			if t == 0 {
+				t = DIRECTORY
+			}
+			items[group] = append(items[group], &Item{
+				Type:        t,
+				Description: route.Description,
+				Selector:    selector,
+			})
+		}
+
+		sort.Strings(groups)
+		for i, group := range groups {
+			if group != "/" {
+				if i > 0 {
+					w.WriteInfo("")
+				}
+				w.WriteInfo(r.MountPoint + group)
+			}
+			for _, item := range items[group] {
+				w.WriteItem(item)
+			}
+		}
+	})
+}
+
+// Remove unregisters the handler for pattern, reporting whether one was
+// registered. Requests already dispatched to it are not affected.
+func (mux *ServeMux) Remove(pattern string) bool {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if _, ok := mux.m[pattern]; !ok {
+		return false
+	}
+	delete(mux.m, pattern)
+
+	segs, wildcard, _ := parsePattern(pattern)
+	mux.tree.remove(segs, wildcard)
+	return true
+}
+
+// Replace registers the handler for the given pattern like Handle, but
+// replaces any handler already registered for pattern, or for a pattern
+// matching exactly the same selectors, instead of panicking. The new
+// handler starts serving requests atomically.
+func (mux *ServeMux) Replace(pattern string, handler Handler, opts ...RouteOption) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	mux.handle(pattern, handler, opts, true)
+}
+
+// Swap atomically replaces the routes registered with mux by the routes
+// registered with routes. It is meant to rebuild a whole set of routes
+// off to the side, in a new ServeMux, and switch it in at once:
+//
+//	routes := gopher.NewServeMux()
+//	routes.HandleFunc("/plugins/foo", foo)
+//	mux.Swap(routes)
+//
+// Every request is dispatched by mux using either the old routes or the
+// new ones, never a mix of both, and requests in flight are not
+// interrupted. Afterwards routes holds the previous routes of mux, so
+// it should not be serving requests itself. Middleware added with Use
+// and the RedirectPolicy stay with their ServeMux.
+func (mux *ServeMux) Swap(routes *ServeMux) {
+	if mux == routes {
+		return
+	}
+
+	routes.mu.Lock()
+	m, tree := routes.m, routes.tree
+	routes.m, routes.tree = nil, routeNode{}
+	routes.mu.Unlock()
+
+	mux.mu.Lock()
+	mux.m, m = m, mux.m
+	mux.tree, tree = tree, mux.tree
+	mux.mu.Unlock()
+
+	routes.mu.Lock()
+	routes.m, routes.tree = m, tree
+	routes.mu.Unlock()
+}
@@ -0,0 +1,168 @@
+package gopher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/about", hello, gopher.Describe("About"), gopher.WithItemType(gopher.FILE))
+	mux.HandleFunc("/posts/", hello, tag("mw"), gopher.Describe("All posts"))
+	mux.HandleFunc("/hidden", hello)
+
+	assert.Equal([]gopher.Route{
+		{Pattern: "/about", Description: "About", Type: gopher.FILE},
+		{Pattern: "/hidden"},
+		{Pattern: "/posts/", Description: "All posts"},
+	}, mux.Routes())
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/posts/x"})
+	assert.Equal("mw /posts/", rec.items[0].Description)
+}
+
+func TestIndexHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/", gopher.IndexHandler(mux))
+	mux.HandleFunc("/about", hello, gopher.Describe("About"), gopher.WithItemType(gopher.FILE))
+	mux.HandleFunc("/posts/", hello, gopher.Describe("All posts"))
+	mux.HandleFunc("/posts/latest", hello, gopher.Describe("Latest post"), gopher.WithItemType(gopher.FILE))
+	mux.HandleFunc("/posts/{id}", hello, gopher.Describe("A post"))
+	mux.HandleFunc("/tags/*tag", hello, gopher.Describe("Tags"))
+	mux.HandleFunc("/tags/popular", hello, gopher.Describe("Popular tags"))
+	mux.HandleFunc("/hidden", hello)
+
+	outer := gopher.NewServeMux()
+	outer.Mount("/api", mux)
+
+	rec := &recorder{}
+	outer.ServeGopher(rec, &gopher.Request{Selector: "/api/"})
+
+	type line struct {
+		Type        gopher.ItemType
+		Description string
+		Selector    string
+	}
+	var lines []line
+	for _, item := range rec.items {
+		lines = append(lines, line{item.Type, item.Description, item.Selector})
+	}
+
+	require.Equal([]line{
+		{gopher.FILE, "About", "/api/about"},
+		{gopher.DIRECTORY, "All posts", "/api/posts/"},
+		{gopher.DIRECTORY, "Tags", "/api/tags/"},
+		{gopher.INFO, "", ""},
+		{gopher.INFO, "/api/posts/", ""},
+		{gopher.FILE, "Latest post", "/api/posts/latest"},
+		{gopher.INFO, "", ""},
+		{gopher.INFO, "/api/tags/", ""},
+		{gopher.DIRECTORY, "Popular tags", "/api/tags/popular"},
+	}, lines)
+
+	// Declared types are used for redirects
+	rec = &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/posts/../about"})
+	require.Len(rec.items, 1)
+	assert.Equal(gopher.FILE, rec.items[0].Type)
+}
+
+func TestServeMuxRemoveReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	say := func(msg string) gopher.HandlerFunc {
+		return func(w gopher.ResponseWriter, r *gopher.Request) {
+			w.WriteInfo(msg)
+		}
+	}
+	serve := func(mux *gopher.ServeMux, selector string) string {
+		rec := &recorder{}
+		mux.ServeGopher(rec, &gopher.Request{Selector: selector})
+		return rec.items[0].Description
+	}
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/posts/{id}", say("post"))
+	mux.Handle("/posts/{id}/comments", say("comments"))
+
+	assert.Equal("post", serve(mux, "/posts/1"))
+	assert.True(mux.Remove("/posts/{id}"))
+	assert.False(mux.Remove("/posts/{id}"))
+	assert.Equal("resource not found", serve(mux, "/posts/1"))
+	assert.Equal("comments", serve(mux, "/posts/1/comments"))
+
+	mux.Replace("/posts/{id}/comments", say("new comments"))
+	assert.Equal("new comments", serve(mux, "/posts/1/comments"))
+
+	// Replacing a conflicting pattern unregisters it
+	mux.Replace("/posts/{slug}/comments", say("slug comments"))
+	assert.Equal("slug comments", serve(mux, "/posts/1/comments"))
+	assert.Equal([]gopher.Route{{Pattern: "/posts/{slug}/comments"}}, mux.Routes())
+
+	mux.Handle("/posts/{id}", say("post again"))
+	assert.Equal("post again", serve(mux, "/posts/1"))
+}
+
+func TestServeMuxSwap(t *testing.T) {
+	assert := assert.New(t)
+
+	say := func(msg string) gopher.HandlerFunc {
+		return func(w gopher.ResponseWriter, r *gopher.Request) {
+			w.WriteInfo(msg)
+		}
+	}
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/a", say("old a"))
+	mux.Handle("/b/", say("old b"))
+
+	routes := gopher.NewServeMux()
+	routes.Handle("/a", say("new a"))
+	routes.Handle("/b", say("new b"))
+
+	done := make(chan struct{})
+	results := make(chan string, 1000)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				rec := &recorder{}
+				mux.ServeGopher(rec, &gopher.Request{Selector: "/b"})
+				results <- rec.items[0].Description
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		mux.Swap(routes)
+	}
+	close(done)
+
+	for len(results) > 0 {
+		r := <-results
+		// "/b" is redirected to "/b/" by the old routes only
+		assert.Contains([]string{"Moved to /b/", "new b"}, r)
+	}
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/a"})
+	assert.Equal("old a", rec.items[0].Description)
+
+	rec = &recorder{}
+	routes.ServeGopher(rec, &gopher.Request{Selector: "/a"})
+	assert.Equal("new a", rec.items[0].Description)
+}
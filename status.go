@@ -0,0 +1,164 @@
+package gopher
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"time"
+)
+
+type statusHandler struct {
+	server *Server
+	allow  []*net.IPNet
+	local  bool
+}
+
+// StatusHandler returns a handler that replies with a menu describing
+// the live state of s, much like Apache's mod_status: uptime, Go
+// runtime statistics, the connections currently being served and the
+// number of requests dispatched to each pattern of the server's
+// ServeMux.
+//
+// By default the status menu is served to any client. If allow is
+// given, only clients whose address matches one of its entries are
+// served; the others receive an error item. Each entry is an IP
+// address, a CIDR block such as "10.0.0.0/8", or "localhost" to allow
+// any loopback address. StatusHandler panics if an entry is invalid.
+//
+//	gopher.Handle("/server-status", gopher.StatusHandler(server, "localhost"))
+func StatusHandler(s *Server, allow ...string) Handler {
+	h := &statusHandler{server: s}
+	for _, a := range allow {
+		if a == "localhost" {
+			h.local = true
+			continue
+		}
+		if ip := net.ParseIP(a); ip != nil {
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			h.allow = append(h.allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			panic("gopher: invalid status allow entry " + a)
+		}
+		h.allow = append(h.allow, ipnet)
+	}
+	return h
+}
+
+func (h *statusHandler) allowed(remoteAddr string) bool {
+	if !h.local && len(h.allow) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	if h.local && ip.IsLoopback() {
+		return true
+	}
+	for _, n := range h.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type connStatus struct {
+	remoteAddr string
+	selector   string
+	elapsed    time.Duration
+}
+
+func (h *statusHandler) ServeGopher(w ResponseWriter, r *Request) {
+	if !h.allowed(r.RemoteAddr) {
+		Error(w, "access denied")
+		return
+	}
+
+	s := h.server
+	now := time.Now()
+
+	s.mu.Lock()
+	started := s.started
+	conns := make([]connStatus, 0, len(s.activeConn))
+	for c := range s.activeConn {
+		conns = append(conns, connStatus{
+			remoteAddr: c.remoteAddr,
+			selector:   c.selector,
+			elapsed:    now.Sub(c.accepted),
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].elapsed > conns[j].elapsed
+	})
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	name := s.Hostname
+	if name == "" {
+		name = s.Addr
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s:%d", r.LocalHost, r.LocalPort)
+	}
+
+	w.WriteInfo("Server status for " + name)
+	w.WriteInfo("")
+	w.WriteInfo("Current time: " + now.Format(time.RFC1123))
+	if !started.IsZero() {
+		w.WriteInfo("Uptime:       " + now.Sub(started).Truncate(time.Second).String())
+	}
+	w.WriteInfo("")
+	w.WriteInfo(fmt.Sprintf("Go version:   %s (%s/%s)", runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	w.WriteInfo(fmt.Sprintf("Goroutines:   %d", runtime.NumGoroutine()))
+	w.WriteInfo(fmt.Sprintf("Heap in use:  %.1f MiB", float64(mem.HeapInuse)/(1<<20)))
+	w.WriteInfo(fmt.Sprintf("GC cycles:    %d", mem.NumGC))
+	w.WriteInfo("")
+
+	w.WriteInfo(fmt.Sprintf("Active connections: %d", len(conns)))
+	for _, c := range conns {
+		selector := c.selector
+		if selector == "" {
+			selector = "(reading request)"
+		}
+		w.WriteInfo(fmt.Sprintf("  %-24s %-32s %s",
+			c.remoteAddr, selector, c.elapsed.Truncate(time.Millisecond)))
+	}
+
+	mux, ok := s.Handler.(*ServeMux)
+	if s.Handler == nil {
+		mux, ok = DefaultServeMux, true
+	}
+	if !ok {
+		return
+	}
+
+	hits := mux.hits()
+	patterns := make([]string, 0, len(hits))
+	for p := range hits {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	w.WriteInfo("")
+	w.WriteInfo("Requests per pattern:")
+	for _, p := range patterns {
+		w.WriteInfo(fmt.Sprintf("  %-32s %d", p, hits[p]))
+	}
+}
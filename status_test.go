@@ -0,0 +1,54 @@
+package gopher_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestStatusHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := gopher.NewServeMux()
+	server := &gopher.Server{Handler: mux}
+	mux.HandleFunc("/hello", hello)
+	mux.Handle("/status", gopher.StatusHandler(server, "localhost"))
+	mux.Handle("/private", gopher.StatusHandler(server, "10.0.0.0/8", "192.168.1.1"))
+
+	addr, stop := startServer(t, server)
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		_, err := gopher.Get(fmt.Sprintf("gopher://%s/1hello", addr))
+		require.NoError(err)
+	}
+
+	res, err := gopher.Get(fmt.Sprintf("gopher://%s/1status", addr))
+	require.NoError(err)
+
+	var lines []string
+	for _, item := range res.Dir.Items {
+		assert.Equal(gopher.INFO, item.Type)
+		lines = append(lines, item.Description)
+	}
+	text := strings.Join(lines, "\n")
+
+	assert.Contains(text, "Uptime:")
+	assert.Contains(text, "Goroutines:")
+	assert.Contains(text, "Active connections: 1")
+	assert.Regexp(`127\.0\.0\.1:\d+ +/status`, text)
+	assert.Regexp(`/hello +2`, text)
+	assert.Regexp(`/status +1`, text)
+
+	res, err = gopher.Get(fmt.Sprintf("gopher://%s/1private", addr))
+	require.NoError(err)
+	require.Len(res.Dir.Items, 1)
+	assert.Equal(gopher.ERROR, res.Dir.Items[0].Type)
+	assert.Equal("access denied", res.Dir.Items[0].Description)
+}
@@ -0,0 +1,107 @@
+package gopher
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A SymlinkPolicy is how a FileHandler serving a Dir treats symbolic
+// links.
+type SymlinkPolicy int
+
+const (
+	// FollowSymlinksInRoot follows the symbolic links that resolve to
+	// a file within the root of the Dir, and treats the others as
+	// missing files.
+	FollowSymlinksInRoot SymlinkPolicy = iota
+
+	// FollowSymlinks follows every symbolic link, wherever it points.
+	FollowSymlinks
+
+	// RefuseSymlinks treats every symbolic link as a missing file.
+	RefuseSymlinks
+)
+
+// check returns an error if file, opened as the file called name in the
+// directory root, may not be served under the policy p. The error
+// satisfies os.IsNotExist.
+//
+// The check is made on the file that was opened rather than on its
+// name, so that a link swapped in while the file is being opened
+// cannot escape the policy.
+func (p SymlinkPolicy) check(file *os.File, root, name string) error {
+	notExist := &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+
+	opened, err := openedPath(file)
+	if err != nil {
+		return notExist
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, opened)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return notExist
+	}
+
+	// the root itself may be a link, but nothing below it: the file
+	// must have been opened by the very name asked for
+	if p == RefuseSymlinks && rel != filepath.Clean(filepath.FromSlash(strings.TrimPrefix(name, "/"))) {
+		return notExist
+	}
+	return nil
+}
+
+// resolveOpened returns the path of file with every symbolic link
+// resolved, checking that it still names the file that was opened.
+func resolveOpened(file *os.File) (string, error) {
+	resolved, err := filepath.EvalSymlinks(file.Name())
+	if err != nil {
+		return "", err
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	current, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !os.SameFile(opened, current) {
+		return "", errors.New("gopher: file changed while being opened")
+	}
+	return filepath.Abs(resolved)
+}
+
+// open opens the file called name in the root of f, under the symlink
+// policy of f.
+func (f *FileHandler) open(name string) (File, error) {
+	d, ok := f.Root.(Dir)
+	if !ok || f.Symlinks == FollowSymlinks {
+		return f.Root.Open(name)
+	}
+	root, err := d.path("/")
+	if err != nil {
+		return nil, err
+	}
+	fullname, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullname)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Symlinks.check(file, root, path.Clean("/"+name)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
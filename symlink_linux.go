@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package gopher
+
+import (
+	"os"
+	"strconv"
+)
+
+// openedPath returns the path of the file that was opened, as the
+// kernel knows it, falling back to resolveOpened where /proc is not
+// mounted.
+func openedPath(file *os.File) (string, error) {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return resolveOpened(file)
+	}
+	var target string
+	var rerr error
+	err = conn.Control(func(fd uintptr) {
+		target, rerr = os.Readlink("/proc/self/fd/" + strconv.FormatUint(uint64(fd), 10))
+	})
+	if err != nil || rerr != nil {
+		return resolveOpened(file)
+	}
+	return target, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package gopher
+
+import "os"
+
+// openedPath returns the path of the file that was opened.
+func openedPath(file *os.File) (string, error) {
+	return resolveOpened(file)
+}
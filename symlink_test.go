@@ -0,0 +1,146 @@
+package gopher_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// symlinkDir creates a root directory holding symbolic links to files
+// inside and outside of it, and returns the directory holding both.
+func symlinkDir(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on windows")
+	}
+	dir := writeTree(t, map[string]string{
+		"root/inside.txt":   "inside",
+		"root/sub/note.txt": "note",
+		"outside.txt":       "outside",
+		"private/key.txt":   "key",
+	})
+	for name, target := range map[string]string{
+		"root/link-in":  "inside.txt",
+		"root/link-out": "../outside.txt",
+		"root/abs-out":  filepath.Join(dir, "outside.txt"),
+		"root/dir-out":  "../private",
+		"root/sub/up":   "..",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))))
+	}
+	return dir
+}
+
+func TestFileServerSymlinks(t *testing.T) {
+	dir := symlinkDir(t)
+	defer os.RemoveAll(dir)
+	root := gopher.Dir(filepath.Join(dir, "root"))
+
+	tests := []struct {
+		policy  gopher.SymlinkPolicy
+		listing []string
+		served  map[string]string
+	}{
+		{
+			gopher.FollowSymlinksInRoot,
+			[]string{"inside.txt", "link-in", "sub"},
+			map[string]string{
+				"/link-in":           "inside",
+				"/sub/up/inside.txt": "inside",
+				"/link-out":          "",
+				"/abs-out":           "",
+				"/dir-out/key.txt":   "",
+			},
+		},
+		{
+			gopher.FollowSymlinks,
+			[]string{"abs-out", "dir-out", "inside.txt", "link-in", "link-out", "sub"},
+			map[string]string{
+				"/link-in":         "inside",
+				"/link-out":        "outside",
+				"/dir-out/key.txt": "key",
+			},
+		},
+		{
+			gopher.RefuseSymlinks,
+			[]string{"inside.txt", "sub"},
+			map[string]string{
+				"/link-in":           "",
+				"/sub/up/inside.txt": "",
+				"/link-out":          "",
+				"/dir-out/key.txt":   "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		h := &gopher.FileHandler{Root: root, Symlinks: tt.policy}
+		assert.Equal(t, tt.listing, descriptions(listing(h, "/")), "policy %d", tt.policy)
+
+		for selector, want := range tt.served {
+			rec := &recorder{}
+			h.ServeGopher(rec, &gopher.Request{Selector: selector})
+			if want != "" {
+				assert.Equal(t, want, rec.body.String(), "policy %d: %s", tt.policy, selector)
+				continue
+			}
+			assert.Zero(t, rec.body.Len(), "policy %d: %s", tt.policy, selector)
+			if assert.Len(t, rec.items, 1, "policy %d: %s", tt.policy, selector) {
+				assert.Equal(t, "resource not found", rec.items[0].Description)
+			}
+		}
+	}
+
+	// dot-dot segments are cleaned before links are resolved
+	h := &gopher.FileHandler{Root: root}
+	items := listing(h, "/sub/../../outside.txt")
+	require.Len(t, items, 1)
+	assert.Equal(t, gopher.ERROR, items[0].Type)
+}
+
+func TestFileServerSymlinkSwap(t *testing.T) {
+	dir := symlinkDir(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	link := filepath.Join(root, "swapped")
+
+	// swap a link between a file inside the root and one outside of
+	// it while it is being served
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			target := "inside.txt"
+			if i%2 == 1 {
+				target = "../outside.txt"
+			}
+			tmp := link + ".tmp"
+			os.Symlink(target, tmp)
+			os.Rename(tmp, link)
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	for _, policy := range []gopher.SymlinkPolicy{gopher.FollowSymlinksInRoot, gopher.RefuseSymlinks} {
+		h := &gopher.FileHandler{Root: gopher.Dir(root), Symlinks: policy}
+		for i := 0; i < 2000; i++ {
+			rec := &recorder{}
+			h.ServeGopher(rec, &gopher.Request{Selector: "/swapped"})
+			require.NotEqual(t, "outside", rec.body.String(), "policy %d", policy)
+		}
+	}
+}
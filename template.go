@@ -0,0 +1,266 @@
+package gopher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+// InfoWidth is the column at which TemplateHandler wraps long lines of
+// text.
+const InfoWidth = 70
+
+// TemplateData is the data a TemplateHandler executes its template
+// with.
+type TemplateData struct {
+	Request  *Request
+	Selector string      // the request's Selector
+	Query    string      // the request's Query
+	Data     interface{} // returned by the TemplateDataFunc, if any
+}
+
+// Param returns the value captured by the named placeholder of the
+// ServeMux pattern that matched the request, as Request.Param.
+func (d *TemplateData) Param(name string) string {
+	return d.Request.Param(name)
+}
+
+// A TemplateDataFunc provides the Data of the TemplateData a template
+// is executed with. If it returns an error, the error is sent to the
+// client instead of the menu.
+type TemplateDataFunc func(r *Request) (interface{}, error)
+
+type templateHandler struct {
+	fs   FileSystem
+	name string
+	data TemplateDataFunc
+
+	mu      sync.Mutex
+	tmpl    *template.Template
+	modTime time.Time
+	size    int64
+}
+
+// TemplateHandler returns a handler that replies with the menu
+// rendered by the text/template file name in fs. The template is
+// parsed on first use and parsed again whenever the file changes.
+//
+// Each line of the template's output is a line of the menu. Lines
+// holding a tab are items written as in a gophermap:
+//
+//	1Phlog<TAB>/phlog/<TAB>host<TAB>port
+//
+// where host and port may be left out to point at the local server.
+// Other lines are text, wrapped at InfoWidth columns. Rather than
+// writing items by hand, templates usually call the item functions:
+//
+//	{{text "About me" "about.txt"}}
+//	{{dir "Phlog" "/phlog/"}}
+//	{{search "Search" "search"}}
+//	{{html "My website" "https://example.com/"}}
+//	{{link "Floodgap" "gopher://gopher.floodgap.com/1/"}}
+//	{{item "I" "A picture" "/pictures/gopher.png"}}
+//	{{error "Something went wrong"}}
+//	{{info .Data.Motd}}
+//
+// Selectors are resolved as documented for Menu, and "html" replaces
+// the builtin of the same name. The "info" function keeps text holding
+// tabs from being mistaken for an item.
+//
+// The template is executed with a *TemplateData, whose Data field holds
+// what data returns for the request; data may be nil.
+//
+//	gopher.Handle("/", gopher.TemplateHandler(gopher.Dir("/srv/gopher"), "index.tmpl", nil))
+func TemplateHandler(fs FileSystem, name string, data TemplateDataFunc) Handler {
+	return &templateHandler{fs: fs, name: name, data: data}
+}
+
+var templateFuncs = template.FuncMap{
+	"text":   itemFunc(FILE),
+	"dir":    itemFunc(DIRECTORY),
+	"search": itemFunc(INDEXSEARCH),
+	"html": func(description, rawurl string) string {
+		return itemLine(&Item{Type: HTML, Description: description, Selector: "URL:" + rawurl})
+	},
+	"link": func(description, rawurl string) string {
+		return itemLine(linkItem(description, rawurl))
+	},
+	"item": func(t, description, selector string) (string, error) {
+		if len(t) != 1 {
+			return "", fmt.Errorf("invalid item type %q", t)
+		}
+		return itemLine(&Item{Type: ItemType(t[0]), Description: description, Selector: selector}), nil
+	},
+	"error": func(msg string) string {
+		return itemLine(&Item{Type: ERROR, Description: msg})
+	},
+	"info": func(text string) string {
+		return strings.Replace(text, "\t", "        ", -1)
+	},
+}
+
+func itemFunc(t ItemType) func(description, selector string) string {
+	return func(description, selector string) string {
+		return itemLine(&Item{Type: t, Description: description, Selector: selector})
+	}
+}
+
+var lineEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// itemLine formats i as a line of template output.
+func itemLine(i *Item) string {
+	line := string(i.Type) + lineEscaper.Replace(i.Description) + "\t" + i.Selector
+	if i.Host != "" {
+		line += "\t" + i.Host + "\t" + strconv.Itoa(i.Port)
+	}
+	return line
+}
+
+// parseMenuLine parses a line holding an item written as in a
+// gophermap. Missing hosts are left empty, and a host without a port
+// means port 70.
+func parseMenuLine(line string) (*Item, error) {
+	parts := strings.Split(line, "\t")
+	if parts[0] == "" {
+		return nil, errors.New("missing item type")
+	}
+
+	i := &Item{
+		Type:        ItemType(parts[0][0]),
+		Description: parts[0][1:],
+		Selector:    parts[1],
+	}
+	if len(parts) > 2 {
+		i.Host = parts[2]
+	}
+	if len(parts) > 3 && parts[3] != "" {
+		port, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", parts[3])
+		}
+		i.Port = port
+	}
+	if i.Host != "" && i.Port == 0 {
+		i.Port = 70
+	}
+	if len(parts) > 4 {
+		i.Extras = parts[4:]
+	}
+	return i, nil
+}
+
+// wrapText breaks text into lines of at most width characters, between
+// words. Words longer than width are not broken.
+func wrapText(text string, width int) []string {
+	if utf8.RuneCountInString(text) <= width {
+		return []string{text}
+	}
+
+	var lines []string
+	line, n := "", 0
+	for _, word := range strings.Fields(text) {
+		wn := utf8.RuneCountInString(word)
+		if n > 0 && n+1+wn > width {
+			lines = append(lines, line)
+			line, n = "", 0
+		}
+		if n > 0 {
+			line += " "
+			n++
+		}
+		line += word
+		n += wn
+	}
+	return append(lines, line)
+}
+
+// template returns the parsed template, parsing it again if the file
+// has changed since it was last parsed.
+func (h *templateHandler) template() (*template.Template, error) {
+	f, err := h.fs.Open(h.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tmpl != nil && fi.ModTime().Equal(h.modTime) && fi.Size() == h.size {
+		return h.tmpl, nil
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(path.Base(h.name)).Funcs(templateFuncs).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	h.tmpl, h.modTime, h.size = t, fi.ModTime(), fi.Size()
+	return t, nil
+}
+
+func (h *templateHandler) ServeGopher(w ResponseWriter, r *Request) {
+	t, err := h.template()
+	if err != nil {
+		w.Server().logf("gopher: template %s: %v", h.name, err)
+		Error(w, "Error reading template")
+		return
+	}
+
+	data := &TemplateData{Request: r, Selector: r.Selector, Query: r.Query}
+	if h.data != nil {
+		if data.Data, err = h.data(r); err != nil {
+			Error(w, err.Error())
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		w.Server().logf("gopher: template %s: %v", h.name, err)
+		Error(w, "Error executing template")
+		return
+	}
+
+	m := NewMenu(r)
+	text := strings.TrimSuffix(buf.String(), "\n")
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.Contains(line, "\t") {
+			for _, l := range wrapText(line, InfoWidth) {
+				m.Info(l)
+			}
+			continue
+		}
+		i, err := parseMenuLine(line)
+		if err != nil {
+			w.Server().logf("gopher: template %s: line %d: %v", h.name, n+1, err)
+			Error(w, "Error executing template")
+			return
+		}
+		m.Add(i)
+	}
+
+	if err := m.Render(w); err != nil {
+		w.Server().logf("gopher: template %s: %v", h.name, err)
+		Error(w, "Error executing template")
+	}
+}
@@ -0,0 +1,105 @@
+package gopher_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func writeTemplate(t *testing.T, dir, text string) {
+	err := ioutil.WriteFile(filepath.Join(dir, "index.tmpl"), []byte(text), 0644)
+	require.NoError(t, err)
+}
+
+func TestTemplateHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "gopher")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	writeTemplate(t, dir, `Posts by {{.Param "author"}}
+{{range .Data}}{{text . (printf "%s.txt" .)}}
+{{end}}
+{{dir "Home" "/"}}
+{{search "Search" "search"}}
+{{link "Floodgap" "gopher://gopher.floodgap.com/1/"}}
+{{html "Website" "https://example.com/"}}
+{{item "I" "Picture" "gopher.png"}}
+{{info "a\ttab"}}
+`+strings.Repeat("word ", 20)+`
+1Raw	/raw	example.org
+`)
+
+	mux := gopher.NewServeMux()
+	mux.Handle("/{author}/", gopher.TemplateHandler(gopher.Dir(dir), "index.tmpl",
+		func(r *gopher.Request) (interface{}, error) {
+			return []string{"first", "second"}, nil
+		}))
+
+	rec := &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/ada/"})
+	require.Len(rec.items, 13)
+
+	assert.Equal(gopher.INFO, rec.items[0].Type)
+	assert.Equal("Posts by ada", rec.items[0].Description)
+	assert.Equal(gopher.Item{Type: gopher.FILE, Description: "first", Selector: "/first.txt"}, *rec.items[1])
+	assert.Equal("/second.txt", rec.items[2].Selector)
+	assert.Equal("", rec.items[3].Description)
+	assert.Equal(gopher.DIRECTORY, rec.items[4].Type)
+	assert.Equal("/search", rec.items[5].Selector)
+	assert.Equal("gopher.floodgap.com", rec.items[6].Host)
+	assert.Equal(70, rec.items[6].Port)
+	assert.Equal("URL:https://example.com/", rec.items[7].Selector)
+	assert.Equal(gopher.IMAGE, rec.items[8].Type)
+	assert.Equal("a        tab", rec.items[9].Description)
+	assert.Equal(strings.TrimSpace(strings.Repeat("word ", 14)), rec.items[10].Description)
+	assert.Equal(strings.TrimSpace(strings.Repeat("word ", 6)), rec.items[11].Description)
+	assert.Equal(gopher.Item{Type: gopher.DIRECTORY, Description: "Raw", Selector: "/raw", Host: "example.org", Port: 70}, *rec.items[12])
+
+	// the template is parsed again once it changes
+	writeTemplate(t, dir, "Changed {{.Selector}} {{.Query}}\n")
+	rec = &recorder{}
+	mux.ServeGopher(rec, &gopher.Request{Selector: "/ada/", Query: "q"})
+	require.Len(rec.items, 1)
+	assert.Equal("Changed /ada/ q", rec.items[0].Description)
+}
+
+func TestTemplateHandlerErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopher")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		template string
+		data     gopher.TemplateDataFunc
+		want     string
+	}{
+		{"{{dir", nil, "Error reading template"},
+		{`{{item "xx" "a" "b"}}`, nil, "Error executing template"},
+		{"hello", func(*gopher.Request) (interface{}, error) {
+			return nil, errors.New("no data")
+		}, "no data"},
+	}
+
+	for _, tt := range tests {
+		writeTemplate(t, dir, tt.template)
+
+		rec := &recorder{}
+		h := gopher.TemplateHandler(gopher.Dir(dir), "index.tmpl", tt.data)
+		h.ServeGopher(rec, &gopher.Request{Selector: "/"})
+		if assert.Len(t, rec.items, 1, tt.template) {
+			assert.Equal(t, gopher.ERROR, rec.items[0].Type, tt.template)
+			assert.Equal(t, tt.want, rec.items[0].Description, tt.template)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package gopher
+
+// A ConnState represents the state of a client connection to a server.
+// It's used by the optional Server.ConnState hook.
+type ConnState int
+
+const (
+	// StateNew represents a new connection that is expected to
+	// send a request immediately. Connections begin at this
+	// state and then transition to either StateActive or
+	// StateClosed.
+	StateNew ConnState = iota
+
+	// StateActive represents a connection that has read a request
+	// and is being served by a handler. Gopher serves a single
+	// request per connection, so there is no idle state: an active
+	// connection transitions to either StateHijacked or StateClosed.
+	StateActive
+
+	// StateHijacked represents a hijacked connection.
+	// This is a terminal state. It does not transition to StateClosed.
+	StateHijacked
+
+	// StateClosed represents a closed connection.
+	// This is a terminal state.
+	StateClosed
+)
+
+var stateName = map[ConnState]string{
+	StateNew:      "new",
+	StateActive:   "active",
+	StateHijacked: "hijacked",
+	StateClosed:   "closed",
+}
+
+func (c ConnState) String() string {
+	return stateName[c]
+}
+
+// ServerTrace is a set of hooks fired while a Server serves a request.
+// Any particular hook may be nil. Hooks are called from the goroutine
+// serving the connection, so they may be used to measure timings of
+// each stage and feed them into a tracing system.
+type ServerTrace struct {
+	// ReadRequestStart is called before the request line is read.
+	ReadRequestStart func()
+
+	// ReadRequestDone is called after the request line has been read
+	// and parsed, with a nil request if that failed.
+	ReadRequestDone func(r *Request, err error)
+
+	// HandlerStart is called before the request is dispatched to the
+	// Server's Handler.
+	HandlerStart func(r *Request)
+
+	// HandlerDone is called after the Server's Handler has returned.
+	HandlerDone func(r *Request)
+
+	// WroteFirstByte is called when the handler writes the first
+	// byte of the response. Output is buffered, so the byte may not
+	// have reached the client yet.
+	WroteFirstByte func(r *Request)
+
+	// ResponseDone is called after the response has been ended and
+	// the connection closed, with any error that occurred doing so.
+	ResponseDone func(r *Request, err error)
+}
+
+func (t *ServerTrace) readRequestStart() {
+	if t != nil && t.ReadRequestStart != nil {
+		t.ReadRequestStart()
+	}
+}
+
+func (t *ServerTrace) readRequestDone(r *Request, err error) {
+	if t != nil && t.ReadRequestDone != nil {
+		t.ReadRequestDone(r, err)
+	}
+}
+
+func (t *ServerTrace) handlerStart(r *Request) {
+	if t != nil && t.HandlerStart != nil {
+		t.HandlerStart(r)
+	}
+}
+
+func (t *ServerTrace) handlerDone(r *Request) {
+	if t != nil && t.HandlerDone != nil {
+		t.HandlerDone(r)
+	}
+}
+
+func (t *ServerTrace) wroteFirstByte(r *Request) {
+	if t != nil && t.WroteFirstByte != nil {
+		t.WroteFirstByte(r)
+	}
+}
+
+func (t *ServerTrace) responseDone(r *Request, err error) {
+	if t != nil && t.ResponseDone != nil {
+		t.ResponseDone(r, err)
+	}
+}
@@ -0,0 +1,71 @@
+package gopher_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestConnStateAndTrace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		mu     sync.Mutex
+		events []string
+		done   = make(chan struct{})
+	)
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	mux := gopher.NewServeMux()
+	mux.HandleFunc("/hello", hello)
+
+	addr, stop := startServer(t, &gopher.Server{
+		Handler: mux,
+		ConnState: func(c net.Conn, state gopher.ConnState) {
+			record("state:" + state.String())
+		},
+		Trace: &gopher.ServerTrace{
+			ReadRequestStart: func() { record("read-start") },
+			ReadRequestDone: func(r *gopher.Request, err error) {
+				record("read-done:" + r.Selector)
+			},
+			HandlerStart:   func(r *gopher.Request) { record("handler-start") },
+			HandlerDone:    func(r *gopher.Request) { record("handler-done") },
+			WroteFirstByte: func(r *gopher.Request) { record("first-byte") },
+			ResponseDone: func(r *gopher.Request, err error) {
+				record(fmt.Sprintf("response-done:%v", err))
+				close(done)
+			},
+		},
+	})
+	defer stop()
+
+	_, err := gopher.Get(fmt.Sprintf("gopher://%s/1hello", addr))
+	require.NoError(err)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]string{
+		"state:new",
+		"read-start",
+		"read-done:/hello",
+		"state:active",
+		"handler-start",
+		"first-byte",
+		"handler-done",
+		"state:closed",
+		"response-done:<nil>",
+	}, events)
+}
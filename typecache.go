@@ -0,0 +1,234 @@
+package gopher
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+// DefaultTypeCacheSize is the number of files whose item types the
+// TypeCache of FileServer remembers.
+const DefaultTypeCacheSize = 10000
+
+// DefaultTypeWorkers is the number of files whose item types a
+// FileHandler detects at once when listing a directory, if its
+// TypeWorkers is zero.
+const DefaultTypeWorkers = 8
+
+// typeKey identifies a version of a file: a change of its size or
+// modification time makes its type be detected again.
+type typeKey struct {
+	root    interface{} // as returned by rootID
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+type typeEntry struct {
+	key typeKey
+	typ ItemType
+}
+
+// A TypeCache remembers the item types detected for files, so that
+// listing a directory again doesn't read its files. It holds at most
+// a fixed number of types, forgetting the least recently used first.
+//
+// A TypeCache may be shared by FileHandlers detecting types the same
+// way, and is safe for concurrent use. Files are told apart by their
+// names and the identity of the Root they are in: the directory of a
+// Dir, or the value or pointer of other file systems. The types of
+// files in a Root whose identity can't be told, such as a struct
+// holding an interface, are not cached.
+type TypeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[typeKey]*list.Element
+	lru     *list.List // of *typeEntry, most recently used first
+}
+
+// NewTypeCache returns a TypeCache holding at most size types.
+func NewTypeCache(size int) *TypeCache {
+	return &TypeCache{
+		size:    size,
+		entries: make(map[typeKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of types in the cache.
+func (c *TypeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// getAll returns the types of the files of keys, or zero for those it
+// doesn't hold. A listing looks all its files up at once, taking the
+// lock a single time.
+func (c *TypeCache) getAll(keys []typeKey) []ItemType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	types := make([]ItemType, len(keys))
+	for i, key := range keys {
+		if e, ok := c.entries[key]; ok {
+			c.lru.MoveToFront(e)
+			types[i] = e.Value.(*typeEntry).typ
+		}
+	}
+	return types
+}
+
+func (c *TypeCache) put(key typeKey, typ ItemType) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*typeEntry).typ = typ
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&typeEntry{key, typ})
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*typeEntry).key)
+	}
+}
+
+// rootID returns a comparable value identifying the file system fsys,
+// or nil if it has none.
+func rootID(fsys interface{}) interface{} {
+	switch fsys := fsys.(type) {
+	case Dir:
+		dir, err := filepath.Abs(fsys.Name())
+		if err != nil {
+			return nil
+		}
+		return Dir(dir)
+	case ioFS:
+		return rootID(fsys.fsys)
+	}
+
+	type pointerID struct {
+		t reflect.Type
+		p uintptr
+	}
+	v := reflect.ValueOf(fsys)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Func, reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return pointerID{v.Type(), v.Pointer()}
+	}
+	if !comparableValues(v.Type()) {
+		return nil
+	}
+	return fsys
+}
+
+// comparableValues reports whether every value of type t can be
+// compared without panicking, which isn't the case of types holding
+// interfaces.
+func comparableValues(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Map, reflect.Slice, reflect.Func:
+		return false
+	case reflect.Array:
+		return comparableValues(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !comparableValues(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// detectTypes sets the types of the items listing files, called names,
+// that have none. Types are taken from the TypeCache of f if it holds
+// them, and the others are detected by at most f.TypeWorkers
+// goroutines at once.
+func (f *FileHandler) detectTypes(items []*Item, names []string, files []os.FileInfo) {
+	var pending []int
+	for i, item := range items {
+		if item.Type != 0 {
+			continue
+		}
+		if files[i].IsDir() {
+			item.Type = DIRECTORY
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	cache := f.TypeCache
+	var root interface{}
+	if cache != nil {
+		if root = rootID(f.Root); root == nil {
+			cache = nil
+		}
+	}
+	key := func(i int) typeKey {
+		return typeKey{root, names[i], files[i].Size(), files[i].ModTime()}
+	}
+
+	if cache != nil && len(pending) > 0 {
+		keys := make([]typeKey, len(pending))
+		for n, i := range pending {
+			keys[n] = key(i)
+		}
+		misses := pending[:0]
+		for n, t := range cache.getAll(keys) {
+			if t == 0 {
+				misses = append(misses, pending[n])
+				continue
+			}
+			items[pending[n]].Type = t
+		}
+		pending = misses
+	}
+
+	detect := func(i int) {
+		t := f.itemType(names[i], files[i])
+		if cache != nil {
+			cache.put(key(i), t)
+		}
+		items[i].Type = t
+	}
+
+	workers := f.TypeWorkers
+	if workers <= 0 {
+		workers = DefaultTypeWorkers
+	}
+	if workers == 1 || len(pending) < 2 {
+		for _, i := range pending {
+			detect(i)
+		}
+		return
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				detect(i)
+			}
+		}()
+	}
+	for _, i := range pending {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
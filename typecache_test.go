@@ -0,0 +1,140 @@
+package gopher_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+// countingFS counts the files opened in a memFS, leaving out
+// directories and sidecar files.
+type countingFS struct {
+	memFS
+	opens int64
+}
+
+func (fs *countingFS) Open(name string) (gopher.File, error) {
+	f, err := fs.memFS.Open(name)
+	if err == nil && !strings.Contains(name, "/.") {
+		if fi, _ := f.Stat(); !fi.IsDir() {
+			atomic.AddInt64(&fs.opens, 1)
+		}
+	}
+	return f, err
+}
+
+func TestFileServerTypeCache(t *testing.T) {
+	fs := &countingFS{memFS: memFS{
+		"/a":     "plain text",
+		"/b":     "GIF89a...",
+		"/c":     "\x00\x01\x02",
+		"/d.txt": "known by its extension",
+		"/sub/e": "plain text",
+	}}
+	cache := gopher.NewTypeCache(10)
+	h := &gopher.FileHandler{Root: fs, TypeCache: cache}
+
+	want := []gopher.ItemType{gopher.FILE, gopher.GIF, gopher.BINARY, gopher.FILE, gopher.DIRECTORY}
+	assert.Equal(t, want, itemTypes(listing(h, "/")))
+	assert.EqualValues(t, 3, fs.opens)
+	assert.Equal(t, 4, cache.Len())
+
+	assert.Equal(t, want, itemTypes(listing(h, "/")))
+	assert.EqualValues(t, 3, fs.opens, "listed again from the cache")
+
+	// a change of size invalidates the cached type
+	fs.memFS["/c"] = "more plain text"
+	want[2] = gopher.FILE
+	assert.Equal(t, want, itemTypes(listing(h, "/")))
+	assert.EqualValues(t, 4, fs.opens)
+
+}
+
+func TestTypeCacheRoots(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	text, gif := "plain text", "GIF89a...."
+	require.Equal(t, len(text), len(gif))
+
+	roots := []struct {
+		name        string
+		first, then gopher.FileSystem
+	}{
+		{"memFS", memFS{"/a": text}, memFS{"/a": gif}},
+		{"FS", gopher.FS(fstest.MapFS{"a": {Data: []byte(text), ModTime: mtime}}),
+			gopher.FS(fstest.MapFS{"a": {Data: []byte(gif), ModTime: mtime}})},
+	}
+	for _, tt := range roots {
+		cache := gopher.NewTypeCache(10)
+		first := &gopher.FileHandler{Root: tt.first, TypeCache: cache}
+		then := &gopher.FileHandler{Root: tt.then, TypeCache: cache}
+
+		assert.Equal(t, []gopher.ItemType{gopher.FILE}, itemTypes(listing(first, "/")), tt.name)
+		assert.Equal(t, []gopher.ItemType{gopher.GIF}, itemTypes(listing(then, "/")), tt.name)
+		assert.Equal(t, []gopher.ItemType{gopher.FILE}, itemTypes(listing(first, "/")), tt.name)
+		assert.Equal(t, 2, cache.Len(), tt.name)
+	}
+}
+
+func TestTypeCacheBounded(t *testing.T) {
+	fs := memFS{}
+	for i := 0; i < 100; i++ {
+		fs[fmt.Sprintf("/f%03d", i)] = "plain text"
+	}
+	cache := gopher.NewTypeCache(16)
+	h := &gopher.FileHandler{Root: fs, TypeCache: cache, TypeWorkers: 4}
+
+	items := listing(h, "/")
+	require.Len(t, items, 100)
+	for _, item := range items {
+		assert.Equal(t, gopher.FILE, item.Type, item.Selector)
+	}
+	assert.Equal(t, 16, cache.Len())
+}
+
+// largeTree creates a directory of n small files of various types.
+func largeTree(b *testing.B, n int) string {
+	contents := []string{"plain text\n", "GIF89a\x01\x00", "<html><body></body></html>", "\x00\x01\x02\x03"}
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("file%05d", i)] = contents[i%len(contents)]
+	}
+	return writeTree(b, files)
+}
+
+func BenchmarkFileServerListing(b *testing.B) {
+	dir := largeTree(b, 10000)
+	defer os.RemoveAll(dir)
+	root := gopher.Dir(dir)
+
+	b.Run("serial", func(b *testing.B) {
+		h := &gopher.FileHandler{Root: root, TypeWorkers: 1}
+		for i := 0; i < b.N; i++ {
+			listing(h, "/")
+		}
+	})
+
+	b.Run("concurrent", func(b *testing.B) {
+		h := &gopher.FileHandler{Root: root}
+		for i := 0; i < b.N; i++ {
+			listing(h, "/")
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		h := &gopher.FileHandler{Root: root, TypeCache: gopher.NewTypeCache(gopher.DefaultTypeCacheSize)}
+		listing(h, "/")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listing(h, "/")
+		}
+	})
+}
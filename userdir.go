@@ -0,0 +1,230 @@
+package gopher
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A UserLookup finds the users of a system and their home directories.
+type UserLookup interface {
+	// Home returns the home directory of the named user, or an error
+	// if there is no such user.
+	Home(name string) (string, error)
+
+	// Users returns the names of all users.
+	Users() ([]string, error)
+}
+
+// errNoUser is returned by UserLookup implementations for unknown users.
+var errNoUser = errors.New("gopher: no such user")
+
+// UserMap is a UserLookup mapping user names to home directories.
+type UserMap map[string]string
+
+// Home returns the home directory of the named user.
+func (m UserMap) Home(name string) (string, error) {
+	home, ok := m[name]
+	if !ok {
+		return "", errNoUser
+	}
+	return home, nil
+}
+
+// Users returns the names of all users, sorted.
+func (m UserMap) Users() ([]string, error) {
+	users := make([]string, 0, len(m))
+	for name := range m {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// PasswdFile is a UserLookup reading the users from a passwd(5) file,
+// such as "/etc/passwd". The file is read again for each lookup.
+type PasswdFile string
+
+func (p PasswdFile) read() (map[string]string, []string, error) {
+	f, err := os.Open(string(p))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	homes := make(map[string]string)
+	var users []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 || fields[0] == "" {
+			continue
+		}
+		if _, ok := homes[fields[0]]; !ok {
+			users = append(users, fields[0])
+		}
+		homes[fields[0]] = fields[5]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return homes, users, nil
+}
+
+// Home returns the home directory of the named user.
+func (p PasswdFile) Home(name string) (string, error) {
+	homes, _, err := p.read()
+	if err != nil {
+		return "", err
+	}
+	home, ok := homes[name]
+	if !ok {
+		return "", errNoUser
+	}
+	return home, nil
+}
+
+// Users returns the names of all users, in the order of the file.
+func (p PasswdFile) Users() ([]string, error) {
+	_, users, err := p.read()
+	return users, err
+}
+
+// UserDirHandler serves the gopherholes of the users of a system,
+// answering selectors of the form "/~name/..." with the files of the
+// directory Dir in the home directory of the user called name.
+//
+// Each gopherhole is served by a copy of Files whose Root is the
+// user's directory, mounted at "/~name" as done by StripPrefix, so
+// gophermaps, listings and links work as they do for FileServer.
+//
+// Other selectors are served by Fallback, which makes it possible to
+// serve the rest of the server alongside the users:
+//
+//	gopher.Handle("/", &gopher.UserDirHandler{
+//		Users:    gopher.PasswdFile("/etc/passwd"),
+//		Index:    true,
+//		Fallback: gopher.FileServer(gopher.Dir("/srv/gopher")),
+//	})
+type UserDirHandler struct {
+	// Users finds the home directories of users. Users whose home
+	// directory is not an absolute path are taken not to exist.
+	Users UserLookup
+
+	// Dir is the directory of a user's gopherhole, relative to their
+	// home directory. If empty, "public_gopher" is used.
+	Dir string
+
+	// Files holds the options of the FileHandler serving each
+	// gopherhole. Its Root is ignored.
+	Files FileHandler
+
+	// Index makes the handler reply to "/~" with a menu linking to
+	// every gopherhole that isn't empty.
+	Index bool
+
+	// Fallback serves the selectors that don't name a user. If nil,
+	// they are answered with a resource not found error.
+	Fallback Handler
+}
+
+// root returns the gopherhole of the named user.
+func (h *UserDirHandler) root(name string) (Dir, error) {
+	if name == "" || strings.ContainsAny(name, "/\\\x00") || name == "." || name == ".." {
+		return "", errNoUser
+	}
+	home, err := h.Users.Home(name)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(home) {
+		// an empty or relative home would lie in the working directory
+		return "", errNoUser
+	}
+	dir := h.Dir
+	if dir == "" {
+		dir = "public_gopher"
+	}
+	return Dir(filepath.Join(home, dir)), nil
+}
+
+// PublicUsers returns the names of the users whose gopherhole holds
+// at least one file that isn't hidden. It may be used as the Users of
+// a FileHandler, to list them in gophermaps.
+func (h *UserDirHandler) PublicUsers() []string {
+	users, err := h.Users.Users()
+	if err != nil {
+		return nil
+	}
+
+	var public []string
+	for _, name := range users {
+		root, err := h.root(name)
+		if err != nil {
+			continue
+		}
+		f, err := root.Open("/")
+		if err != nil {
+			continue
+		}
+		files, _ := f.Readdir(-1)
+		f.Close()
+		for _, fi := range files {
+			if !strings.HasPrefix(fi.Name(), ".") {
+				public = append(public, name)
+				break
+			}
+		}
+	}
+	return public
+}
+
+func (h *UserDirHandler) ServeGopher(w ResponseWriter, r *Request) {
+	if !strings.HasPrefix(r.Selector, "/~") {
+		if h.Fallback == nil {
+			NotFound(w, r)
+			return
+		}
+		h.Fallback.ServeGopher(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.Selector, "/~")
+	if name == "" || name == "/" {
+		if !h.Index {
+			NotFound(w, r)
+			return
+		}
+		for _, u := range h.PublicUsers() {
+			w.WriteItem(&Item{Type: DIRECTORY, Description: "~" + u, Selector: "/~" + u + "/"})
+		}
+		return
+	}
+
+	rest := ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	root, err := h.root(name)
+	if err != nil {
+		NotFound(w, r)
+		return
+	}
+	if rest == "" {
+		Redirect(w, r, &Item{Type: DIRECTORY, Selector: r.Selector + "/"})
+		return
+	}
+
+	files := h.Files
+	files.Root = root
+	StripPrefix("/~"+name, &files).ServeGopher(w, r)
+}
@@ -0,0 +1,109 @@
+package gopher_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/writefreely/go-gopher"
+)
+
+func TestUserDirHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	homes := writeTree(t, map[string]string{
+		"ada/public_gopher/notes.txt":     "Ada's notes.\n",
+		"ada/public_gopher/sub/gophermap": "Welcome\n0Notes\t../notes.txt\n",
+		"bob/public_gopher/.hidden":       "",
+		"eve/other.txt":                   "",
+	})
+	defer os.RemoveAll(homes)
+
+	wd, err := os.Getwd()
+	require.NoError(err)
+	relative, err := filepath.Rel(wd, filepath.Join(homes, "ada"))
+	require.NoError(err)
+
+	h := &gopher.UserDirHandler{
+		Users: gopher.UserMap{
+			"ada": filepath.Join(homes, "ada"),
+			"bob": filepath.Join(homes, "bob"),
+			"eve": filepath.Join(homes, "eve"),
+			"rel": relative,
+			"nil": "",
+		},
+		Index:    true,
+		Fallback: gopher.HandlerFunc(hello),
+	}
+
+	assert.Equal([]string{"ada"}, h.PublicUsers())
+
+	rec := &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/~"})
+	require.Len(rec.items, 1)
+	assert.Equal(gopher.Item{Type: gopher.DIRECTORY, Description: "~ada", Selector: "/~ada/"}, *rec.items[0])
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/~ada/"})
+	require.Len(rec.items, 2)
+	assert.Equal("/~ada/notes.txt", rec.items[0].Selector)
+	assert.Equal("/~ada/sub", rec.items[1].Selector)
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/~ada/sub/"})
+	require.Len(rec.items, 2)
+	assert.Equal("Welcome", rec.items[0].Description)
+	assert.Equal("/~ada/notes.txt", rec.items[1].Selector)
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/~ada/notes.txt"})
+	assert.Equal("Ada's notes.\n", rec.body.String())
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/~ada"})
+	require.Len(rec.items, 1)
+	assert.Equal("/~ada/", rec.items[0].Selector)
+
+	for _, selector := range []string{"/~nobody/", "/~../", "/~ada/../../eve/other.txt", "/~rel/notes.txt", "/~nil/"} {
+		rec = &recorder{}
+		h.ServeGopher(rec, &gopher.Request{Selector: selector})
+		if assert.Len(rec.items, 1, selector) {
+			assert.Equal(gopher.ERROR, rec.items[0].Type, selector)
+		}
+	}
+
+	rec = &recorder{}
+	h.ServeGopher(rec, &gopher.Request{Selector: "/about"})
+	require.Len(rec.items, 1)
+	assert.Equal("Hello World!", rec.items[0].Description)
+}
+
+func TestPasswdFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "passwd")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("# users\n" +
+		"root:x:0:0:root:/root:/bin/sh\n" +
+		"ada:x:1000:1000:Ada:/home/ada:/bin/sh\n" +
+		"broken line\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p := gopher.PasswdFile(f.Name())
+	users, err := p.Users()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root", "ada"}, users)
+
+	home, err := p.Home("ada")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/ada", home)
+
+	_, err = p.Home("bob")
+	assert.Error(t, err)
+}